@@ -1,6 +1,9 @@
 package api
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type Block interface {
 	// cache blocks
@@ -24,11 +27,18 @@ type Block interface {
 	DeleteAllBlocks(ctx context.Context) error              //perm:admin
 
 	RemoveWaitCacheBlockWith(ctx context.Context, carfileCID string) error //perm:admin
+
+	// import CAR file or directory in local path to block store, and report to scheduler as a cache of carfile
+	ImportCarfile(ctx context.Context, path string, expiredTime time.Time) (ImportCarfileResult, error) //perm:admin
+	// export DAG of carfile in block store to CARv1 file in local path
+	ExportCarfile(ctx context.Context, carfileCid, path string) (ExportCarfileResult, error) //perm:admin
 }
 
 type BlockCacheInfo struct {
 	Cid string
 	Fid int
+	// sign of block for downloading from peer edge, signed by scheduler with the key of peer edge
+	Sign string
 
 	// From string
 }
@@ -39,6 +49,16 @@ type ReqCacheData struct {
 	DownloadToken string
 	CardFileHash  string
 	CacheID       string
+	// reliability of carfile, node evict the blocks of low reliability carfile first
+	Reliability int
+	// carfile with higher priority is cached first
+	Priority int
+	// download blocks from the download server of a peer edge,
+	// DownloadToken is the query of url, every block is signed by scheduler in BlockCacheInfo
+	FromEdge bool
+	// fingerprint of self-signed certificate of peer edge download server, node pin it when FromEdge,
+	// empty if certificate is not self-signed
+	DownloadCertFingerprint string
 }
 
 type BlockOperationResult struct {
@@ -46,20 +66,35 @@ type BlockOperationResult struct {
 	ErrMsg string
 }
 
-// (WaitCacheBlockNum + DoingCacheBlockNum )* (retryNum * DownloadTimeout)
+// (WaitCacheBlockNum + DoingCacheBlockNum) * (BlockDownloadRetryNum + 1) - RetryNum tries left, every try cost DownloadTimeout at most
 type CacheStat struct {
 	CacheBlockCount    int
 	WaitCacheBlockNum  int
 	DoingCacheBlockNum int
-	// retry download number
+	// sum of retry count of the loading blocks
 	RetryNum int
 	// timeout of download, seconds
 	DownloadTimeout int
 	DiskUsage       float64
+	// hit and miss count of in-memory block cache of download server
+	HotCacheHits   int64
+	HotCacheMisses int64
+}
+
+// CacheQueueInfo blocks of cache which were waiting in node queue
+type CacheQueueInfo struct {
+	CarfileHash string
+	CacheID     string
+	BlockCount  int
 }
 
+// CachingWorkerWaiting block is waiting in queue, not loading by any worker
+const CachingWorkerWaiting = -1
+
 type CachingBlockStat struct {
-	Cid             string
+	Cid string
+	// id of the loader worker
+	Worker          int
 	DownloadPercent float32
 	DownloadSpeed   float32
 	// milliseconds
@@ -69,3 +104,17 @@ type CachingBlockStat struct {
 type CachingBlockList struct {
 	List []CachingBlockStat
 }
+
+type ImportCarfileResult struct {
+	CarfileCid string
+	CacheID    string
+	// number of blocks saved in block store
+	Blocks    int
+	TotalSize int64
+}
+
+type ExportCarfileResult struct {
+	CarfileCid string
+	Blocks     int
+	TotalSize  int64
+}
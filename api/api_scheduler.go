@@ -13,29 +13,29 @@ type Scheduler interface {
 	Web
 
 	// call by command
-	GetOnlineDeviceIDs(ctx context.Context, nodeType NodeTypeName) ([]string, error)                    //perm:read
-	ElectionValidators(ctx context.Context) error                                                       //perm:admin                                                               //perm:admin
-	QueryCacheStatWithNode(ctx context.Context, deviceID string) ([]CacheStat, error)                   //perm:read
-	QueryCachingBlocksWithNode(ctx context.Context, deviceID string) (CachingBlockList, error)          //perm:read
-	CacheCarfile(ctx context.Context, cid string, reliability int, expiredTime time.Time) error         //perm:admin
-	RemoveCarfile(ctx context.Context, carfileID string) error                                          //perm:admin
-	RemoveCache(ctx context.Context, carfileID, cacheID string) error                                   //perm:admin
-	GetCacheData(ctx context.Context, cid string) (DataInfo, error)                                     //perm:read
-	ListCacheDatas(ctx context.Context, page int) (DataListInfo, error)                                 //perm:read
-	ShowRunningCacheDatas(ctx context.Context) ([]DataInfo, error)                                      //perm:read
-	RegisterNode(ctx context.Context, nodeType NodeType, count int) ([]NodeRegisterInfo, error)         //perm:admin
-	DeleteBlockRecords(ctx context.Context, deviceID string, cids []string) (map[string]string, error)  //perm:admin
-	CacheContinue(ctx context.Context, cid, cacheID string) error                                       //perm:admin
-	ValidateSwitch(ctx context.Context, open bool) error                                                //perm:admin
-	ValidateRunningState(ctx context.Context) (bool, error)                                             //perm:admin
-	ValidateStart(ctx context.Context) error                                                            //perm:admin
-	ListEvents(ctx context.Context, page int) (EventListInfo, error)                                    //perm:read
-	ResetCacheExpiredTime(ctx context.Context, carfileCid, cacheID string, expiredTime time.Time) error //perm:admin
-	ReplenishCacheExpiredTime(ctx context.Context, carfileCid, cacheID string, hour int) error          //perm:admin
-	NodeQuit(ctx context.Context, device string) error                                                  //perm:admin
-	StopCacheTask(ctx context.Context, carfileCid string) error                                         //perm:admin
-	GetBlocksCacheError(ctx context.Context, cacheID string) ([]*CacheError, error)                     //perm:read
-	RedressDeveiceInfo(ctx context.Context, deviceID string) error                                      //perm:admin
+	GetOnlineDeviceIDs(ctx context.Context, nodeType NodeTypeName) ([]string, error)                      //perm:read
+	ElectionValidators(ctx context.Context) error                                                         //perm:admin                                                               //perm:admin
+	QueryCacheStatWithNode(ctx context.Context, deviceID string) ([]CacheStat, error)                     //perm:read
+	QueryCachingBlocksWithNode(ctx context.Context, deviceID string) (CachingBlockList, error)            //perm:read
+	CacheCarfile(ctx context.Context, cid string, reliability, priority int, expiredTime time.Time) error //perm:admin
+	RemoveCarfile(ctx context.Context, carfileID string) error                                            //perm:admin
+	RemoveCache(ctx context.Context, carfileID, cacheID string) error                                     //perm:admin
+	GetCacheData(ctx context.Context, cid string) (DataInfo, error)                                       //perm:read
+	ListCacheDatas(ctx context.Context, page int) (DataListInfo, error)                                   //perm:read
+	ShowRunningCacheDatas(ctx context.Context) ([]DataInfo, error)                                        //perm:read
+	RegisterNode(ctx context.Context, nodeType NodeType, count int) ([]NodeRegisterInfo, error)           //perm:admin
+	DeleteBlockRecords(ctx context.Context, deviceID string, cids []string) (map[string]string, error)    //perm:admin
+	CacheContinue(ctx context.Context, cid, cacheID string) error                                         //perm:admin
+	ValidateSwitch(ctx context.Context, open bool) error                                                  //perm:admin
+	ValidateRunningState(ctx context.Context) (bool, error)                                               //perm:admin
+	ValidateStart(ctx context.Context) error                                                              //perm:admin
+	ListEvents(ctx context.Context, page int) (EventListInfo, error)                                      //perm:read
+	ResetCacheExpiredTime(ctx context.Context, carfileCid, cacheID string, expiredTime time.Time) error   //perm:admin
+	ReplenishCacheExpiredTime(ctx context.Context, carfileCid, cacheID string, hour int) error            //perm:admin
+	NodeQuit(ctx context.Context, device string) error                                                    //perm:admin
+	StopCacheTask(ctx context.Context, carfileCid string) error                                           //perm:admin
+	GetBlocksCacheError(ctx context.Context, cacheID string) ([]*CacheError, error)                       //perm:read
+	RedressDeveiceInfo(ctx context.Context, deviceID string) error                                        //perm:admin
 
 	// call by locator
 	LocatorConnect(ctx context.Context, edgePort int, areaID, locatorID, locatorToken string) error //perm:write
@@ -43,6 +43,12 @@ type Scheduler interface {
 	// call by node
 	// node send result when user download block complete
 	NodeResultForUserDownloadBlock(ctx context.Context, result NodeBlockDownloadResult) error                        //perm:write
+	NodeReconcileResult(ctx context.Context, report ReconcileReport) error                                           //perm:write
+	NodeCacheQueueResumed(ctx context.Context, stat CacheStat, queue []CacheQueueInfo) error                         //perm:write
+	NodeAllocateFids(ctx context.Context, count int) (int, error)                                                    //perm:write
+	NodeImportCarfile(ctx context.Context, info ImportCarfileInfo) (ImportCacheInfo, error)                          //perm:write
+	NodeDownloadSrvCertFingerprint(ctx context.Context, fingerprint string) error                                    //perm:write
+	NodeReportCorruptedBlocks(ctx context.Context, cids []string) error                                              //perm:write
 	EdgeNodeConnect(ctx context.Context, rpcURL, downloadSrvURL string) error                                        //perm:write
 	ValidateBlockResult(ctx context.Context, validateResults ValidateResults) error                                  //perm:write
 	CandidateNodeConnect(ctx context.Context, rpcURL, downloadSrvURL string) error                                   //perm:write
@@ -57,6 +63,9 @@ type Scheduler interface {
 	GetDownloadInfosWithBlocks(ctx context.Context, cids []string, publicKey string) (map[string][]DownloadInfoResult, error) //perm:read
 	GetDownloadInfoWithBlocks(ctx context.Context, cids []string, publicKey string) (map[string]DownloadInfoResult, error)    //perm:read
 	GetDownloadInfoWithBlock(ctx context.Context, cid, publicKey string) (DownloadInfoResult, error)                          //perm:read
+	GetBatchDownloadInfo(ctx context.Context, cids []string, publicKey string) (BatchDownloadInfoResult, error)               //perm:read
+	GetDownloadInfoWithCarfile(ctx context.Context, cid, publicKey string) (DownloadInfoResult, error)                        //perm:read
+	GetDownloadInfoWithGateway(ctx context.Context, cid, publicKey string) (DownloadInfoResult, error)                        //perm:read
 	GetDevicesInfo(ctx context.Context, deviceID string) (DevicesInfo, error)                                                 //perm:read
 	GetDownloadInfo(ctx context.Context, deviceID string) ([]*BlockDownloadInfo, error)                                       //perm:read
 
@@ -109,9 +118,12 @@ type CacheResultInfo struct {
 	Msg           string
 	From          string
 	DownloadSpeed float32
+	// caching of carfile was cancelled before the block was cached
+	Cancelled bool
 	// links cid
 	Links     []string
 	BlockSize int
+	// cumulative size of links, links of dag-cbor and dag-json have no size
 	LinksSize uint64
 
 	CarFileHash string
@@ -119,6 +131,21 @@ type CacheResultInfo struct {
 	// Fid        int
 }
 
+// ImportCarfileInfo blocks of carfile imported by node, fid of blocks were allocated by NodeAllocateFids
+type ImportCarfileInfo struct {
+	CarfileCid string
+	// empty in the first batch, scheduler create a new cache for the node
+	CacheID     string
+	ExpiredTime time.Time
+	Blocks      []BlockCacheInfo
+}
+
+// ImportCacheInfo cache of the carfile imported by node
+type ImportCacheInfo struct {
+	CacheID     string
+	Reliability int
+}
+
 // DataInfo Data info
 type DataInfo struct {
 	CarfileCid      string      `db:"carfile_cid"`
@@ -136,6 +163,8 @@ type DataInfo struct {
 
 	CacheInfos  []CacheInfo
 	DataTimeout time.Duration
+	// carfile with higher priority is cached first by nodes
+	Priority int
 }
 
 // CacheInfo Data Block info
@@ -184,6 +213,14 @@ type NodeBlockDownloadResult struct {
 	FailedReason string
 }
 
+// failed reason prefix of download request rejected by node
+const (
+	// DownloadFailedSignExpired signTime+timeout of request is passed
+	DownloadFailedSignExpired = "sign expired"
+	// DownloadFailedSnReplayed sn of request was used, and the request is not a range request continuing the same content
+	DownloadFailedSnReplayed = "sn replayed"
+)
+
 type DownloadServerAccessAuth struct {
 	DeviceID   string
 	URL        string
@@ -205,6 +242,16 @@ type DownloadInfoResult struct {
 	SignTime int64
 	TimeOut  int
 	DeviceID string `json:"-"`
+	// fingerprint of self-signed certificate of https download server, client pin it, empty if not self-signed
+	CertFingerprint string
+}
+
+// BatchDownloadInfoResult download the blocks of Cids from one node with one request,
+// the content signed by scheduler and user is manifest hash of Cids instead of cid
+type BatchDownloadInfoResult struct {
+	DownloadInfoResult
+	// cids held by the node, in order of request
+	Cids []string
 }
 
 type CandidateDownloadInfo struct {
@@ -228,6 +275,8 @@ const (
 	CacheStatusTimeout
 	// CacheStatusRestore status
 	CacheStatusRestore
+	// CacheStatusCancel status
+	CacheStatusCancel
 )
 
 // CacheError cache error
@@ -1,6 +1,9 @@
 package api
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type DataSync interface {
 	// get all block check sum
@@ -9,6 +12,8 @@ type DataSync interface {
 	GetChecksumsInRange(ctx context.Context, reqCheckSum ReqChecksumInRange) (ChecksumRsp, error) //perm:write
 	// scrub block that is repair blockstore
 	ScrubBlocks(ctx context.Context, scrub ScrubBlocks) error //perm:write
+	// reconcile block store with fid and hash relation, dry run only report what to repair
+	Reconcile(ctx context.Context, dryRun bool) (ReconcileReport, error) //perm:admin
 }
 
 type ScrubBlocks struct {
@@ -38,3 +43,22 @@ type ReqChecksumInRange struct {
 	// rsp max group num
 	MaxGroupNum int
 }
+
+type ReconcileReport struct {
+	DryRun bool
+	// number of fid checked
+	FidCount int
+	// number of blocks in block store checked
+	BlockCount int
+	// blocks in block store but has no fid, were removed
+	OrphanBlocks int
+	// blocks has fid but not in block store, were refetched
+	MissingBlocks int
+	// relation of hash and fid which was repaired
+	FixedKeys int
+	// part of the cids of orphan and missing blocks
+	OrphanCids  []string
+	RefetchCids []string
+	StartTime   time.Time
+	EndTime     time.Time
+}
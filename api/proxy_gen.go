@@ -26,10 +26,14 @@ type BlockStruct struct {
 
 		DeleteBlocks func(p0 context.Context, p1 []string) ([]BlockOperationResult, error) `perm:"write"`
 
+		ExportCarfile func(p0 context.Context, p1 string, p2 string) (ExportCarfileResult, error) `perm:"admin"`
+
 		GetCID func(p0 context.Context, p1 string) (string, error) `perm:"read"`
 
 		GetFID func(p0 context.Context, p1 string) (string, error) `perm:"read"`
 
+		ImportCarfile func(p0 context.Context, p1 string, p2 time.Time) (ImportCarfileResult, error) `perm:"admin"`
+
 		LoadBlock func(p0 context.Context, p1 string) ([]byte, error) `perm:"read"`
 
 		QueryCacheStat func(p0 context.Context) (CacheStat, error) `perm:"read"`
@@ -110,6 +114,8 @@ type DataSyncStruct struct {
 
 		GetChecksumsInRange func(p0 context.Context, p1 ReqChecksumInRange) (ChecksumRsp, error) `perm:"write"`
 
+		Reconcile func(p0 context.Context, p1 bool) (ReconcileReport, error) `perm:"admin"`
+
 		ScrubBlocks func(p0 context.Context, p1 ScrubBlocks) error `perm:"write"`
 	}
 }
@@ -215,7 +221,7 @@ type SchedulerStruct struct {
 
 		AuthNodeVerify func(p0 context.Context, p1 string) ([]auth.Permission, error) `perm:"read"`
 
-		CacheCarfile func(p0 context.Context, p1 string, p2 int, p3 time.Time) error `perm:"admin"`
+		CacheCarfile func(p0 context.Context, p1 string, p2 int, p3 int, p4 time.Time) error `perm:"admin"`
 
 		CacheContinue func(p0 context.Context, p1 string, p2 string) error `perm:"admin"`
 
@@ -229,6 +235,8 @@ type SchedulerStruct struct {
 
 		ElectionValidators func(p0 context.Context) error `perm:"admin"`
 
+		GetBatchDownloadInfo func(p0 context.Context, p1 []string, p2 string) (BatchDownloadInfoResult, error) `perm:"read"`
+
 		GetBlocksCacheError func(p0 context.Context, p1 string) ([]*CacheError, error) `perm:"read"`
 
 		GetCacheData func(p0 context.Context, p1 string) (DataInfo, error) `perm:"read"`
@@ -243,6 +251,10 @@ type SchedulerStruct struct {
 
 		GetDownloadInfoWithBlocks func(p0 context.Context, p1 []string, p2 string) (map[string]DownloadInfoResult, error) `perm:"read"`
 
+		GetDownloadInfoWithCarfile func(p0 context.Context, p1 string, p2 string) (DownloadInfoResult, error) `perm:"read"`
+
+		GetDownloadInfoWithGateway func(p0 context.Context, p1 string, p2 string) (DownloadInfoResult, error) `perm:"read"`
+
 		GetDownloadInfosWithBlocks func(p0 context.Context, p1 []string, p2 string) (map[string][]DownloadInfoResult, error) `perm:"read"`
 
 		GetExternalIP func(p0 context.Context) (string, error) `perm:"write"`
@@ -257,8 +269,20 @@ type SchedulerStruct struct {
 
 		LocatorConnect func(p0 context.Context, p1 int, p2 string, p3 string, p4 string) error `perm:"write"`
 
+		NodeAllocateFids func(p0 context.Context, p1 int) (int, error) `perm:"write"`
+
+		NodeCacheQueueResumed func(p0 context.Context, p1 CacheStat, p2 []CacheQueueInfo) error `perm:"write"`
+
+		NodeDownloadSrvCertFingerprint func(p0 context.Context, p1 string) error `perm:"write"`
+
+		NodeImportCarfile func(p0 context.Context, p1 ImportCarfileInfo) (ImportCacheInfo, error) `perm:"write"`
+
 		NodeQuit func(p0 context.Context, p1 string) error `perm:"admin"`
 
+		NodeReconcileResult func(p0 context.Context, p1 ReconcileReport) error `perm:"write"`
+
+		NodeReportCorruptedBlocks func(p0 context.Context, p1 []string) error `perm:"write"`
+
 		NodeResultForUserDownloadBlock func(p0 context.Context, p1 NodeBlockDownloadResult) error `perm:"write"`
 
 		QueryCacheStatWithNode func(p0 context.Context, p1 string) ([]CacheStat, error) `perm:"read"`
@@ -400,6 +424,17 @@ func (s *BlockStub) DeleteBlocks(p0 context.Context, p1 []string) ([]BlockOperat
 	return *new([]BlockOperationResult), ErrNotSupported
 }
 
+func (s *BlockStruct) ExportCarfile(p0 context.Context, p1 string, p2 string) (ExportCarfileResult, error) {
+	if s.Internal.ExportCarfile == nil {
+		return *new(ExportCarfileResult), ErrNotSupported
+	}
+	return s.Internal.ExportCarfile(p0, p1, p2)
+}
+
+func (s *BlockStub) ExportCarfile(p0 context.Context, p1 string, p2 string) (ExportCarfileResult, error) {
+	return *new(ExportCarfileResult), ErrNotSupported
+}
+
 func (s *BlockStruct) GetCID(p0 context.Context, p1 string) (string, error) {
 	if s.Internal.GetCID == nil {
 		return "", ErrNotSupported
@@ -422,6 +457,17 @@ func (s *BlockStub) GetFID(p0 context.Context, p1 string) (string, error) {
 	return "", ErrNotSupported
 }
 
+func (s *BlockStruct) ImportCarfile(p0 context.Context, p1 string, p2 time.Time) (ImportCarfileResult, error) {
+	if s.Internal.ImportCarfile == nil {
+		return *new(ImportCarfileResult), ErrNotSupported
+	}
+	return s.Internal.ImportCarfile(p0, p1, p2)
+}
+
+func (s *BlockStub) ImportCarfile(p0 context.Context, p1 string, p2 time.Time) (ImportCarfileResult, error) {
+	return *new(ImportCarfileResult), ErrNotSupported
+}
+
 func (s *BlockStruct) LoadBlock(p0 context.Context, p1 string) ([]byte, error) {
 	if s.Internal.LoadBlock == nil {
 		return *new([]byte), ErrNotSupported
@@ -620,6 +666,17 @@ func (s *DataSyncStub) GetChecksumsInRange(p0 context.Context, p1 ReqChecksumInR
 	return *new(ChecksumRsp), ErrNotSupported
 }
 
+func (s *DataSyncStruct) Reconcile(p0 context.Context, p1 bool) (ReconcileReport, error) {
+	if s.Internal.Reconcile == nil {
+		return *new(ReconcileReport), ErrNotSupported
+	}
+	return s.Internal.Reconcile(p0, p1)
+}
+
+func (s *DataSyncStub) Reconcile(p0 context.Context, p1 bool) (ReconcileReport, error) {
+	return *new(ReconcileReport), ErrNotSupported
+}
+
 func (s *DataSyncStruct) ScrubBlocks(p0 context.Context, p1 ScrubBlocks) error {
 	if s.Internal.ScrubBlocks == nil {
 		return ErrNotSupported
@@ -840,14 +897,14 @@ func (s *SchedulerStub) AuthNodeVerify(p0 context.Context, p1 string) ([]auth.Pe
 	return *new([]auth.Permission), ErrNotSupported
 }
 
-func (s *SchedulerStruct) CacheCarfile(p0 context.Context, p1 string, p2 int, p3 time.Time) error {
+func (s *SchedulerStruct) CacheCarfile(p0 context.Context, p1 string, p2 int, p3 int, p4 time.Time) error {
 	if s.Internal.CacheCarfile == nil {
 		return ErrNotSupported
 	}
-	return s.Internal.CacheCarfile(p0, p1, p2, p3)
+	return s.Internal.CacheCarfile(p0, p1, p2, p3, p4)
 }
 
-func (s *SchedulerStub) CacheCarfile(p0 context.Context, p1 string, p2 int, p3 time.Time) error {
+func (s *SchedulerStub) CacheCarfile(p0 context.Context, p1 string, p2 int, p3 int, p4 time.Time) error {
 	return ErrNotSupported
 }
 
@@ -917,6 +974,17 @@ func (s *SchedulerStub) ElectionValidators(p0 context.Context) error {
 	return ErrNotSupported
 }
 
+func (s *SchedulerStruct) GetBatchDownloadInfo(p0 context.Context, p1 []string, p2 string) (BatchDownloadInfoResult, error) {
+	if s.Internal.GetBatchDownloadInfo == nil {
+		return *new(BatchDownloadInfoResult), ErrNotSupported
+	}
+	return s.Internal.GetBatchDownloadInfo(p0, p1, p2)
+}
+
+func (s *SchedulerStub) GetBatchDownloadInfo(p0 context.Context, p1 []string, p2 string) (BatchDownloadInfoResult, error) {
+	return *new(BatchDownloadInfoResult), ErrNotSupported
+}
+
 func (s *SchedulerStruct) GetBlocksCacheError(p0 context.Context, p1 string) ([]*CacheError, error) {
 	if s.Internal.GetBlocksCacheError == nil {
 		return *new([]*CacheError), ErrNotSupported
@@ -994,6 +1062,28 @@ func (s *SchedulerStub) GetDownloadInfoWithBlocks(p0 context.Context, p1 []strin
 	return *new(map[string]DownloadInfoResult), ErrNotSupported
 }
 
+func (s *SchedulerStruct) GetDownloadInfoWithCarfile(p0 context.Context, p1 string, p2 string) (DownloadInfoResult, error) {
+	if s.Internal.GetDownloadInfoWithCarfile == nil {
+		return *new(DownloadInfoResult), ErrNotSupported
+	}
+	return s.Internal.GetDownloadInfoWithCarfile(p0, p1, p2)
+}
+
+func (s *SchedulerStub) GetDownloadInfoWithCarfile(p0 context.Context, p1 string, p2 string) (DownloadInfoResult, error) {
+	return *new(DownloadInfoResult), ErrNotSupported
+}
+
+func (s *SchedulerStruct) GetDownloadInfoWithGateway(p0 context.Context, p1 string, p2 string) (DownloadInfoResult, error) {
+	if s.Internal.GetDownloadInfoWithGateway == nil {
+		return *new(DownloadInfoResult), ErrNotSupported
+	}
+	return s.Internal.GetDownloadInfoWithGateway(p0, p1, p2)
+}
+
+func (s *SchedulerStub) GetDownloadInfoWithGateway(p0 context.Context, p1 string, p2 string) (DownloadInfoResult, error) {
+	return *new(DownloadInfoResult), ErrNotSupported
+}
+
 func (s *SchedulerStruct) GetDownloadInfosWithBlocks(p0 context.Context, p1 []string, p2 string) (map[string][]DownloadInfoResult, error) {
 	if s.Internal.GetDownloadInfosWithBlocks == nil {
 		return *new(map[string][]DownloadInfoResult), ErrNotSupported
@@ -1071,6 +1161,50 @@ func (s *SchedulerStub) LocatorConnect(p0 context.Context, p1 int, p2 string, p3
 	return ErrNotSupported
 }
 
+func (s *SchedulerStruct) NodeAllocateFids(p0 context.Context, p1 int) (int, error) {
+	if s.Internal.NodeAllocateFids == nil {
+		return *new(int), ErrNotSupported
+	}
+	return s.Internal.NodeAllocateFids(p0, p1)
+}
+
+func (s *SchedulerStub) NodeAllocateFids(p0 context.Context, p1 int) (int, error) {
+	return *new(int), ErrNotSupported
+}
+
+func (s *SchedulerStruct) NodeCacheQueueResumed(p0 context.Context, p1 CacheStat, p2 []CacheQueueInfo) error {
+	if s.Internal.NodeCacheQueueResumed == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.NodeCacheQueueResumed(p0, p1, p2)
+}
+
+func (s *SchedulerStub) NodeCacheQueueResumed(p0 context.Context, p1 CacheStat, p2 []CacheQueueInfo) error {
+	return ErrNotSupported
+}
+
+func (s *SchedulerStruct) NodeDownloadSrvCertFingerprint(p0 context.Context, p1 string) error {
+	if s.Internal.NodeDownloadSrvCertFingerprint == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.NodeDownloadSrvCertFingerprint(p0, p1)
+}
+
+func (s *SchedulerStub) NodeDownloadSrvCertFingerprint(p0 context.Context, p1 string) error {
+	return ErrNotSupported
+}
+
+func (s *SchedulerStruct) NodeImportCarfile(p0 context.Context, p1 ImportCarfileInfo) (ImportCacheInfo, error) {
+	if s.Internal.NodeImportCarfile == nil {
+		return *new(ImportCacheInfo), ErrNotSupported
+	}
+	return s.Internal.NodeImportCarfile(p0, p1)
+}
+
+func (s *SchedulerStub) NodeImportCarfile(p0 context.Context, p1 ImportCarfileInfo) (ImportCacheInfo, error) {
+	return *new(ImportCacheInfo), ErrNotSupported
+}
+
 func (s *SchedulerStruct) NodeQuit(p0 context.Context, p1 string) error {
 	if s.Internal.NodeQuit == nil {
 		return ErrNotSupported
@@ -1082,6 +1216,28 @@ func (s *SchedulerStub) NodeQuit(p0 context.Context, p1 string) error {
 	return ErrNotSupported
 }
 
+func (s *SchedulerStruct) NodeReconcileResult(p0 context.Context, p1 ReconcileReport) error {
+	if s.Internal.NodeReconcileResult == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.NodeReconcileResult(p0, p1)
+}
+
+func (s *SchedulerStub) NodeReconcileResult(p0 context.Context, p1 ReconcileReport) error {
+	return ErrNotSupported
+}
+
+func (s *SchedulerStruct) NodeReportCorruptedBlocks(p0 context.Context, p1 []string) error {
+	if s.Internal.NodeReportCorruptedBlocks == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.NodeReportCorruptedBlocks(p0, p1)
+}
+
+func (s *SchedulerStub) NodeReportCorruptedBlocks(p0 context.Context, p1 []string) error {
+	return ErrNotSupported
+}
+
 func (s *SchedulerStruct) NodeResultForUserDownloadBlock(p0 context.Context, p1 NodeBlockDownloadResult) error {
 	if s.Internal.NodeResultForUserDownloadBlock == nil {
 		return ErrNotSupported
@@ -0,0 +1,236 @@
+package blockstore
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"time"
+
+	dgbadger "github.com/dgraph-io/badger/v2"
+	"github.com/ipfs/go-datastore"
+	"github.com/linguohua/titan/node/fsutil"
+)
+
+const (
+	// value log gc interval
+	badgerGCInterval = 10 * time.Minute
+	// rewrite a value log file if at least half of it can be discarded
+	badgerGCDiscardRatio = 0.5
+)
+
+type badgerStore struct {
+	Path string
+	db   *dgbadger.DB
+}
+
+func openBadgerStore(path string) (*badgerStore, error) {
+	opts := dgbadger.DefaultOptions(path).WithTruncate(true).
+		WithValueThreshold(1 << 10)
+
+	db, err := dgbadger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	bs := &badgerStore{Path: path, db: db}
+	go bs.startGC()
+
+	log.Infof("open badger block store success, path:%s", path)
+	return bs, nil
+}
+
+func (bs *badgerStore) startGC() {
+	ticker := time.NewTicker(badgerGCInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if bs.db.IsClosed() {
+			return
+		}
+
+		for {
+			// RunValueLogGC rewrites at most one file per call
+			err := bs.db.RunValueLogGC(badgerGCDiscardRatio)
+			if err != nil {
+				if err != dgbadger.ErrNoRewrite && err != dgbadger.ErrRejected {
+					log.Errorf("badger value log gc error:%s", err.Error())
+				}
+				break
+			}
+		}
+	}
+}
+
+func (bs *badgerStore) Type() string {
+	return "Badger"
+}
+
+func (bs *badgerStore) GetPath() string {
+	return bs.Path
+}
+
+func (bs *badgerStore) Put(key string, value []byte) error {
+	return bs.db.Update(func(txn *dgbadger.Txn) error {
+		return txn.Set([]byte(key), value)
+	})
+}
+
+// PutReader read the whole block, badger write it in one transaction
+func (bs *badgerStore) PutReader(key string, r io.Reader) (int64, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(data)), bs.Put(key, data)
+}
+
+func (bs *badgerStore) Get(key string) ([]byte, error) {
+	var data []byte
+	err := bs.db.View(func(txn *dgbadger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+
+		data, err = item.ValueCopy(nil)
+		return err
+	})
+
+	if err == dgbadger.ErrKeyNotFound {
+		return nil, datastore.ErrNotFound
+	}
+
+	return data, err
+}
+
+func (bs *badgerStore) Delete(key string) error {
+	return bs.db.Update(func(txn *dgbadger.Txn) error {
+		_, err := txn.Get([]byte(key))
+		if err == dgbadger.ErrKeyNotFound {
+			return datastore.ErrNotFound
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return txn.Delete([]byte(key))
+	})
+}
+
+// GetReader copy the value to memory, because value of badger is only valid in the transaction,
+// it is no more than the max size of block, use FileStore if blocks are too large to be held in memory
+func (bs *badgerStore) GetReader(key string) (BlockReader, error) {
+	data, err := bs.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bytesReader{bytes.NewReader(data)}, nil
+}
+
+func (bs *badgerStore) Has(key string) (exists bool, err error) {
+	err = bs.db.View(func(txn *dgbadger.Txn) error {
+		_, err := txn.Get([]byte(key))
+		return err
+	})
+
+	if err == nil {
+		return true, nil
+	}
+
+	if err == dgbadger.ErrKeyNotFound {
+		return false, nil
+	}
+
+	return false, err
+}
+
+func (bs *badgerStore) GetSize(key string) (size int, err error) {
+	err = bs.db.View(func(txn *dgbadger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+
+		size = int(item.ValueSize())
+		return nil
+	})
+
+	if err == dgbadger.ErrKeyNotFound {
+		return 0, datastore.ErrNotFound
+	}
+
+	return size, err
+}
+
+func (bs *badgerStore) Stat() (fsutil.FsStat, error) {
+	return fsutil.Statfs(bs.Path)
+}
+
+func (bs *badgerStore) KeyCount() (int, error) {
+	count := 0
+	err := bs.ForEachKey(func(key string) error {
+		count++
+		return nil
+	})
+
+	return count, err
+}
+
+func (bs *badgerStore) GetAllKeys() ([]string, error) {
+	keys := make([]string, 0)
+	err := bs.ForEachKey(func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+
+	if err != nil {
+		return []string{}, err
+	}
+
+	return keys, nil
+}
+
+// ForEachKey iterate keys only in key order, values in value log will not be read
+func (bs *badgerStore) ForEachKey(f func(key string) error) error {
+	return bs.db.View(func(txn *dgbadger.Txn) error {
+		opts := dgbadger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := f(string(it.Item().Key())); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (bs *badgerStore) Close() error {
+	return bs.db.Close()
+}
+
+type bytesReader struct {
+	r *bytes.Reader
+}
+
+func (r *bytesReader) Read(p []byte) (n int, err error) {
+	return r.r.Read(p)
+}
+
+func (r *bytesReader) Close() error {
+	return nil
+}
+
+func (r *bytesReader) Seek(offset int64, whence int) (int64, error) {
+	return r.r.Seek(offset, whence)
+}
+
+func (r *bytesReader) Size() int64 {
+	return r.r.Size()
+}
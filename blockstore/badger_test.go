@@ -0,0 +1,76 @@
+package blockstore
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+)
+
+func TestBadgerStore(t *testing.T) {
+	bs, err := openBadgerStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bs.Close()
+
+	key := "1220abcd"
+	value := []byte("hello titan")
+
+	if err := bs.Put(key, value); err != nil {
+		t.Fatal(err)
+	}
+
+	exist, err := bs.Has(key)
+	if err != nil || !exist {
+		t.Fatalf("Has %s, exist:%v, err:%v", key, exist, err)
+	}
+
+	reader, err := bs.GetReader(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reader.Size() != int64(len(value)) {
+		t.Fatalf("reader size %d, expect %d", reader.Size(), len(value))
+	}
+
+	if _, err := reader.Seek(6, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.Close()
+
+	if string(data) != "titan" {
+		t.Fatalf("read after seek %s, expect titan", string(data))
+	}
+
+	count, err := bs.KeyCount()
+	if err != nil || count != 1 {
+		t.Fatalf("KeyCount %d, err:%v", count, err)
+	}
+
+	if err := bs.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bs.Get(key); err != datastore.ErrNotFound {
+		t.Fatalf("Get deleted key, err:%v", err)
+	}
+
+	if err := bs.Delete(key); err != datastore.ErrNotFound {
+		t.Fatalf("Delete deleted key, err:%v", err)
+	}
+}
+
+func TestUnsupportedBlockStoreType(t *testing.T) {
+	for _, storeType := range []string{"RocksDB", "LevelDB"} {
+		if _, err := NewBlockStoreFromString(storeType, t.TempDir()); err == nil {
+			t.Fatalf("block store type %s should not be opened", storeType)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package blockstore
 
 import (
+	"fmt"
 	"io"
 	"os"
 
@@ -12,6 +13,8 @@ var log = logging.Logger("stores")
 
 type BlockStore interface {
 	Put(key string, value []byte) error
+	// PutReader write block from reader, the block is visible only after all data was written
+	PutReader(key string, r io.Reader) (int64, error)
 	Get(key string) ([]byte, error)
 	Delete(key string) error
 	GetReader(key string) (BlockReader, error)
@@ -19,6 +22,8 @@ type BlockStore interface {
 	Stat() (fsutil.FsStat, error)
 	KeyCount() (int, error)
 	GetAllKeys() ([]string, error)
+	// ForEachKey iterate keys in ascending order without loading all of them to memory, stop if f return error
+	ForEachKey(f func(key string) error) error
 	GetPath() string
 	// GetSize(ctx context.Context, key string) (size int, err error)
 }
@@ -29,21 +34,26 @@ func NewBlockStore(path string, storeType string) BlockStore {
 		log.Fatalf("NewBlockStore, path:%s, err:%s", path, err.Error())
 	}
 
-	return NewBlockStoreFromString(storeType, path)
+	bs, err := NewBlockStoreFromString(storeType, path)
+	if err != nil {
+		log.Fatalf("NewBlockStore, path:%s, err:%s", path, err.Error())
+	}
+
+	return bs
 }
 
-func NewBlockStoreFromString(t string, path string) BlockStore {
+// NewBlockStoreFromString open the block store of type, return error if the type is not supported
+func NewBlockStoreFromString(t string, path string) (BlockStore, error) {
 	switch t {
+	case "Badger":
+		return openBadgerStore(path)
 	case "RocksDB":
-		// RocksDB.Path = path
-		// return &RocksDB
-		return nil
+		return nil, fmt.Errorf("block store type RocksDB is not supported, use Badger or FileStore")
 	case "FileStore":
-		fs := &fileStore{Path: path}
-		return fs
+		return newFileStore(path), nil
 
 	default:
-		panic("unknown BlockStore type")
+		return nil, fmt.Errorf("unknown block store type %s", t)
 	}
 }
 
@@ -0,0 +1,129 @@
+package blockstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// block smaller than this will not be compressed
+	compressMinSize = 512
+	// keep the compressed data only if it is smaller than compressMaxRatio of the original
+	compressMaxRatio = 0.9
+
+	compressMethodStored = 0
+	compressMethodZstd   = 1
+)
+
+// magic(4) + method(1) + logical size(8)
+var compressMagic = []byte{'T', 'Z', 'C', 0x01}
+
+const compressHeaderLen = 13
+
+// compressStore compress blocks with zstd before write them to block store,
+// blocks written without header, such as blocks saved before compress enable, are read as it is
+type compressStore struct {
+	BlockStore
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func NewCompressBlockStore(bs BlockStore) BlockStore {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		log.Fatalf("NewCompressBlockStore, new encoder err:%s", err.Error())
+	}
+
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		log.Fatalf("NewCompressBlockStore, new decoder err:%s", err.Error())
+	}
+
+	return &compressStore{BlockStore: bs, encoder: encoder, decoder: decoder}
+}
+
+func (cs *compressStore) Put(key string, value []byte) error {
+	return cs.BlockStore.Put(key, cs.encode(value))
+}
+
+// PutReader have to read the whole block to know the compression ratio
+func (cs *compressStore) PutReader(key string, r io.Reader) (int64, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = cs.BlockStore.PutReader(key, bytes.NewReader(cs.encode(data)))
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(data)), nil
+}
+
+func (cs *compressStore) Get(key string) ([]byte, error) {
+	data, err := cs.BlockStore.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cs.decode(data)
+}
+
+// GetReader return the original block, Size() of reader is the logical size
+func (cs *compressStore) GetReader(key string) (BlockReader, error) {
+	data, err := cs.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bytesReader{bytes.NewReader(data)}, nil
+}
+
+func (cs *compressStore) encode(value []byte) []byte {
+	if len(value) >= compressMinSize {
+		compressed := cs.encoder.EncodeAll(value, make([]byte, compressHeaderLen, compressHeaderLen+len(value)))
+		if float64(len(compressed)) < float64(len(value))*compressMaxRatio {
+			writeCompressHeader(compressed, compressMethodZstd, len(value))
+			return compressed
+		}
+	}
+
+	// the original data may be taken as header, must store it with header
+	if bytes.HasPrefix(value, compressMagic) {
+		stored := make([]byte, compressHeaderLen, compressHeaderLen+len(value))
+		writeCompressHeader(stored, compressMethodStored, len(value))
+		return append(stored, value...)
+	}
+
+	return value
+}
+
+func (cs *compressStore) decode(data []byte) ([]byte, error) {
+	if len(data) < compressHeaderLen || !bytes.HasPrefix(data, compressMagic) {
+		return data, nil
+	}
+
+	method := data[len(compressMagic)]
+	size := binary.BigEndian.Uint64(data[len(compressMagic)+1 : compressHeaderLen])
+
+	switch method {
+	case compressMethodStored:
+		return data[compressHeaderLen:], nil
+	case compressMethodZstd:
+		return cs.decoder.DecodeAll(data[compressHeaderLen:], make([]byte, 0, size))
+	default:
+		// not a header written by compressStore
+		return data, nil
+	}
+}
+
+func writeCompressHeader(buf []byte, method byte, size int) {
+	copy(buf, compressMagic)
+	buf[len(compressMagic)] = method
+	binary.BigEndian.PutUint64(buf[len(compressMagic)+1:compressHeaderLen], uint64(size))
+}
@@ -0,0 +1,55 @@
+package blockstore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestCompressStore(t *testing.T) {
+	fs := newFileStore(t.TempDir())
+	cs := NewCompressBlockStore(fs)
+
+	random := make([]byte, 4096)
+	rand.Read(random) //nolint:errcheck
+
+	values := map[string][]byte{
+		"compressible": bytes.Repeat([]byte("titan "), 1000),
+		"random":       random,
+		"magic":        append(append([]byte{}, compressMagic...), []byte("not a header")...),
+	}
+
+	for key, value := range values {
+		if err := cs.Put(key, value); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := cs.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(data, value) {
+			t.Fatalf("block %s not match after decompress", key)
+		}
+
+		reader, err := cs.GetReader(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if reader.Size() != int64(len(value)) {
+			t.Fatalf("block %s reader size %d, expect %d", key, reader.Size(), len(value))
+		}
+		reader.Close()
+	}
+
+	raw, err := fs.Get("compressible")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(raw) >= len(values["compressible"]) {
+		t.Fatalf("compressible block was not compressed, size %d", len(raw))
+	}
+}
@@ -0,0 +1,115 @@
+package blockstore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+var encryptMagic = []byte{'T', 'E', 'C', 0x01}
+
+// encryptStore encrypt blocks with AES-GCM before write them to block store,
+// the key of block is used as additional data, so block can not be moved to other key.
+// Every block is encrypted, block without header is rejected, blocks saved before encrypt enable
+// have to be migrated to a new encrypted block store
+type encryptStore struct {
+	BlockStore
+	aead cipher.AEAD
+}
+
+// NewEncryptBlockStore key must be 16, 24 or 32 bytes
+func NewEncryptBlockStore(bs BlockStore, key []byte) BlockStore {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		log.Fatalf("NewEncryptBlockStore, new cipher err:%s", err.Error())
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		log.Fatalf("NewEncryptBlockStore, new gcm err:%s", err.Error())
+	}
+
+	return &encryptStore{BlockStore: bs, aead: aead}
+}
+
+func (es *encryptStore) Put(key string, value []byte) error {
+	data, err := es.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+
+	return es.BlockStore.Put(key, data)
+}
+
+// PutReader have to read the whole block, gcm can not encrypt stream
+func (es *encryptStore) PutReader(key string, r io.Reader) (int64, error) {
+	value, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := es.encrypt(key, value)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = es.BlockStore.PutReader(key, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(value)), nil
+}
+
+func (es *encryptStore) Get(key string) ([]byte, error) {
+	data, err := es.BlockStore.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return es.decrypt(key, data)
+}
+
+// GetReader return the plain block, Size() of reader is the size of plain block
+func (es *encryptStore) GetReader(key string) (BlockReader, error) {
+	data, err := es.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bytesReader{bytes.NewReader(data)}, nil
+}
+
+// magic + nonce + cipher text
+func (es *encryptStore) encrypt(key string, value []byte) ([]byte, error) {
+	headerLen := len(encryptMagic) + es.aead.NonceSize()
+
+	buf := make([]byte, headerLen, headerLen+len(value)+es.aead.Overhead())
+	copy(buf, encryptMagic)
+
+	nonce := buf[len(encryptMagic):headerLen]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return es.aead.Seal(buf, nonce, value, []byte(key)), nil
+}
+
+func (es *encryptStore) decrypt(key string, data []byte) ([]byte, error) {
+	headerLen := len(encryptMagic) + es.aead.NonceSize()
+	if len(data) < headerLen || !bytes.HasPrefix(data, encryptMagic) {
+		return nil, fmt.Errorf("block %s is not encrypted", key)
+	}
+
+	nonce := data[len(encryptMagic):headerLen]
+	plain, err := es.aead.Open(nil, nonce, data[headerLen:], []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt block %s error:%s", key, err.Error())
+	}
+
+	return plain, nil
+}
@@ -0,0 +1,109 @@
+package blockstore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+)
+
+func newTestEncryptStore(t *testing.T) (*fileStore, BlockStore) {
+	key := make([]byte, 32)
+	rand.Read(key) //nolint:errcheck
+
+	fs := newFileStore(t.TempDir())
+	return fs, NewEncryptBlockStore(fs, key)
+}
+
+func TestEncryptStore(t *testing.T) {
+	fs, es := newTestEncryptStore(t)
+
+	values := map[string][]byte{
+		"block": bytes.Repeat([]byte("titan "), 1000),
+		"empty": {},
+		// plain block look like encrypted header is encrypted as well
+		"magic": append(append([]byte{}, encryptMagic...), []byte("not a header")...),
+	}
+
+	for key, value := range values {
+		if _, err := es.PutReader(key, bytes.NewReader(value)); err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := fs.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(value) > 0 && bytes.Contains(stored, value) {
+			t.Fatalf("block %s is stored as plain text", key)
+		}
+
+		data, err := es.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(data, value) {
+			t.Fatalf("block %s not match after decrypt", key)
+		}
+
+		reader, err := es.GetReader(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err = ioutil.ReadAll(reader)
+		reader.Close() //nolint:errcheck
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(data, value) || reader.Size() != int64(len(value)) {
+			t.Fatalf("block %s reader not match after decrypt", key)
+		}
+	}
+}
+
+func TestEncryptStoreTamper(t *testing.T) {
+	fs, es := newTestEncryptStore(t)
+
+	value := []byte("titan encrypted block")
+	if err := es.Put("block", value); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := fs.Get("block")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flip one bit of cipher text
+	tampered := append([]byte{}, stored...)
+	tampered[len(tampered)-1] ^= 0x01
+	if err := fs.Put("tampered", tampered); err != nil {
+		t.Fatal(err)
+	}
+
+	// block moved to other key
+	if err := fs.Put("moved", stored); err != nil {
+		t.Fatal(err)
+	}
+
+	// plain block saved without encryption
+	if err := fs.Put("plain", value); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"tampered", "moved", "plain"} {
+		if _, err := es.Get(key); err == nil {
+			t.Fatalf("get %s block should fail", key)
+		}
+	}
+
+	// another key can not decrypt
+	_, other := newTestEncryptStore(t)
+	if _, err := other.(*encryptStore).decrypt("block", stored); err == nil {
+		t.Fatal("decrypt with other key should fail")
+	}
+}
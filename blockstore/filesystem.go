@@ -1,17 +1,56 @@
 package blockstore
 
 import (
+	"bytes"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/ipfs/go-datastore"
 	"github.com/linguohua/titan/node/fsutil"
 )
 
+const (
+	// block was written to temp file first, then rename to key
+	tmpFilePrefix = ".tmp-"
+	// number of names read from directory every time when iterate keys
+	readNamesBatch = 1024
+	// number of keys sorted in memory when iterate keys in order
+	sortKeysRunSize = 100 * readNamesBatch
+)
+
 type fileStore struct {
 	Path string
 }
 
+func newFileStore(path string) *fileStore {
+	fs := &fileStore{Path: path}
+	fs.removeTempFiles()
+	return fs
+}
+
+// remove temp files which left by crash
+func (fs *fileStore) removeTempFiles() {
+	names, err := fs.readNames()
+	if err != nil {
+		log.Errorf("removeTempFiles, path:%s, err:%s", fs.Path, err.Error())
+		return
+	}
+
+	for _, name := range names {
+		if !strings.HasPrefix(name, tmpFilePrefix) {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(fs.Path, name))
+		if err != nil {
+			log.Errorf("removeTempFiles, remove %s err:%s", name, err.Error())
+		}
+	}
+}
+
 func (fs *fileStore) Type() string {
 	return "FileStore"
 }
@@ -21,8 +60,55 @@ func (fs *fileStore) GetPath() string {
 }
 
 func (fs *fileStore) Put(key string, value []byte) error {
-	filePath := filepath.Join(fs.Path, key)
-	return os.WriteFile(filePath, value, 0644)
+	_, err := fs.PutReader(key, bytes.NewReader(value))
+	return err
+}
+
+// PutReader write to temp file and sync, then rename to the key,
+// so crash in the middle of writing will not leave a truncated block
+func (fs *fileStore) PutReader(key string, r io.Reader) (int64, error) {
+	tmpFile, err := os.CreateTemp(fs.Path, tmpFilePrefix+key+"-*")
+	if err != nil {
+		return 0, err
+	}
+	tmpPath := tmpFile.Name()
+
+	n, err := io.Copy(tmpFile, r)
+	if err == nil {
+		err = tmpFile.Chmod(0644)
+	}
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(tmpPath) //nolint:errcheck
+		return 0, err
+	}
+
+	err = os.Rename(tmpPath, filepath.Join(fs.Path, key))
+	if err != nil {
+		os.Remove(tmpPath) //nolint:errcheck
+		return 0, err
+	}
+
+	return n, fs.syncDir()
+}
+
+// sync directory to make sure rename was persisted
+func (fs *fileStore) syncDir() error {
+	dir, err := os.Open(fs.Path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close() //nolint:errcheck
+
+	return dir.Sync()
 }
 
 func (fs *fileStore) Get(key string) ([]byte, error) {
@@ -98,38 +184,95 @@ func (fs *fileStore) DiskUsage() (int64, error) {
 }
 
 func (fs *fileStore) KeyCount() (int, error) {
-	dir, err := os.Open(fs.Path)
+	keys, err := fs.GetAllKeys()
 	if err != nil {
 		return 0, err
 	}
-	defer dir.Close() //nolint:errcheck
 
-	files, err := dir.Readdir(-1)
+	return len(keys), nil
+}
+
+func (fs *fileStore) GetAllKeys() ([]string, error) {
+	names, err := fs.readNames()
 	if err != nil {
-		return 0, err
+		return []string{}, err
 	}
 
-	return len(files), nil
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		// skip temp files
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		keys = append(keys, name)
+	}
+
+	return keys, nil
 }
 
-func (fs *fileStore) GetAllKeys() ([]string, error) {
+// ForEachKey iterate keys in ascending order with bounded memory,
+// names of directory are sorted in runs of sortKeysRunSize and written to temp files, then the runs are merged
+func (fs *fileStore) ForEachKey(f func(key string) error) error {
 	dir, err := os.Open(fs.Path)
 	if err != nil {
-		return []string{}, err
+		return err
 	}
 	defer dir.Close() //nolint:errcheck
 
-	files, err := dir.Readdir(-1)
-	if err != nil {
-		return []string{}, err
+	runs := make([]string, 0)
+	defer func() {
+		for _, run := range runs {
+			os.Remove(run) //nolint:errcheck
+		}
+	}()
+
+	keys := make([]string, 0, readNamesBatch)
+	for {
+		names, err := dir.Readdirnames(readNamesBatch)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			// skip temp files
+			if strings.HasPrefix(name, ".") {
+				continue
+			}
+			keys = append(keys, name)
+		}
+
+		if len(keys) >= sortKeysRunSize {
+			run, err := sortedKeysRun(fs.Path, keys)
+			if err != nil {
+				return err
+			}
+			runs = append(runs, run)
+			keys = keys[:0]
+		}
 	}
 
-	keys := make([]string, 0, len(files))
-	for _, file := range files {
-		keys = append(keys, file.Name())
+	sort.Strings(keys)
+
+	iterators := []keyIterator{sliceIterator(keys)}
+	for _, run := range runs {
+		iterators = append(iterators, runIterator(run))
 	}
 
-	return keys, nil
+	return mergeSortedKeys(iterators, f)
+}
+
+func (fs *fileStore) readNames() ([]string, error) {
+	dir, err := os.Open(fs.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close() //nolint:errcheck
+
+	return dir.Readdirnames(-1)
 }
 
 type fileReader struct {
@@ -0,0 +1,211 @@
+package blockstore
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"sync"
+)
+
+// block larger than capacity/hotCacheMaxBlockDivisor will not be cached,
+// avoid a few big blocks flush the whole cache
+const hotCacheMaxBlockDivisor = 8
+
+// HotCache keep the recently read blocks in memory, the total size of blocks is limited by capacity.
+// Put and Delete through HotCache invalidate the cached block,
+// if block was deleted from the underlying store directly, must call Invalidate
+type HotCache struct {
+	BlockStore
+	capacity int64
+	size     int64
+	// front is the most recently used
+	lru    *list.List
+	blocks map[string]*list.Element
+	// blocks are reading from the underlying store
+	loads  map[string]*hotLoad
+	hits   int64
+	misses int64
+	lock   *sync.Mutex
+}
+
+type hotBlock struct {
+	key  string
+	data []byte
+}
+
+// hotLoad is stale if the block was invalidated while reading it,
+// the data read will not be cached
+type hotLoad struct {
+	refs  int
+	stale bool
+}
+
+func NewHotCache(bs BlockStore, capacity int64) *HotCache {
+	return &HotCache{
+		BlockStore: bs,
+		capacity:   capacity,
+		lru:        list.New(),
+		blocks:     make(map[string]*list.Element),
+		loads:      make(map[string]*hotLoad),
+		lock:       &sync.Mutex{},
+	}
+}
+
+// Put, PutReader and Delete invalidate the block before and after change the underlying store,
+// the block read by concurrent Get before the change will not be cached
+func (hc *HotCache) Put(key string, value []byte) error {
+	hc.Invalidate(key)
+	defer hc.Invalidate(key)
+
+	return hc.BlockStore.Put(key, value)
+}
+
+func (hc *HotCache) PutReader(key string, r io.Reader) (int64, error) {
+	hc.Invalidate(key)
+	defer hc.Invalidate(key)
+
+	return hc.BlockStore.PutReader(key, r)
+}
+
+func (hc *HotCache) Delete(key string) error {
+	hc.Invalidate(key)
+	defer hc.Invalidate(key)
+
+	return hc.BlockStore.Delete(key)
+}
+
+func (hc *HotCache) Get(key string) ([]byte, error) {
+	data, load, ok := hc.get(key)
+	if ok {
+		return data, nil
+	}
+
+	data, err := hc.BlockStore.Get(key)
+	if err != nil {
+		hc.endLoad(key, load, nil)
+		return nil, err
+	}
+
+	hc.endLoad(key, load, data)
+	return data, nil
+}
+
+// GetReader return the block in memory if cached,
+// big block which can not be cached is read from the underlying store
+func (hc *HotCache) GetReader(key string) (BlockReader, error) {
+	data, load, ok := hc.get(key)
+	if ok {
+		return &bytesReader{bytes.NewReader(data)}, nil
+	}
+
+	reader, err := hc.BlockStore.GetReader(key)
+	if err != nil {
+		hc.endLoad(key, load, nil)
+		return nil, err
+	}
+
+	if reader.Size() > hc.capacity/hotCacheMaxBlockDivisor {
+		hc.endLoad(key, load, nil)
+		return reader, nil
+	}
+	defer reader.Close()
+
+	data = make([]byte, reader.Size())
+	_, err = io.ReadFull(reader, data)
+	if err != nil {
+		hc.endLoad(key, load, nil)
+		return nil, err
+	}
+
+	hc.endLoad(key, load, data)
+	return &bytesReader{bytes.NewReader(data)}, nil
+}
+
+// Invalidate remove the block from cache
+func (hc *HotCache) Invalidate(key string) {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+
+	if e, ok := hc.blocks[key]; ok {
+		hc.remove(e)
+	}
+
+	if load, ok := hc.loads[key]; ok {
+		load.stale = true
+	}
+}
+
+// CacheStat return the hit and miss count of cache
+func (hc *HotCache) CacheStat() (hits int64, misses int64) {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+
+	return hc.hits, hc.misses
+}
+
+// get return the cached block, or start loading the block if it is not cached,
+// endLoad must be called with the load after read the underlying store
+func (hc *HotCache) get(key string) ([]byte, *hotLoad, bool) {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+
+	e, ok := hc.blocks[key]
+	if !ok {
+		hc.misses++
+
+		load, ok := hc.loads[key]
+		if !ok {
+			load = &hotLoad{}
+			hc.loads[key] = load
+		}
+		load.refs++
+
+		return nil, load, false
+	}
+
+	hc.hits++
+	hc.lru.MoveToFront(e)
+	return e.Value.(*hotBlock).data, nil, true
+}
+
+// endLoad cache the data read from the underlying store if the block was not invalidated during loading
+func (hc *HotCache) endLoad(key string, load *hotLoad, data []byte) {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+
+	load.refs--
+	if load.refs == 0 {
+		delete(hc.loads, key)
+	}
+
+	if data == nil || load.stale {
+		return
+	}
+
+	hc.add(key, data)
+}
+
+// add must be called with lock
+func (hc *HotCache) add(key string, data []byte) {
+	size := int64(len(data))
+	if size > hc.capacity/hotCacheMaxBlockDivisor {
+		return
+	}
+
+	if e, ok := hc.blocks[key]; ok {
+		hc.remove(e)
+	}
+
+	for hc.size+size > hc.capacity && hc.lru.Len() > 0 {
+		hc.remove(hc.lru.Back())
+	}
+
+	hc.blocks[key] = hc.lru.PushFront(&hotBlock{key: key, data: data})
+	hc.size += size
+}
+
+func (hc *HotCache) remove(e *list.Element) {
+	block := hc.lru.Remove(e).(*hotBlock)
+	delete(hc.blocks, block.key)
+	hc.size -= int64(len(block.data))
+}
@@ -0,0 +1,94 @@
+package blockstore
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHotCache(t *testing.T) {
+	fs := newFileStore(t.TempDir())
+	hc := NewHotCache(fs, 8*1024)
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := hc.Put(key, bytes.Repeat([]byte(key), 1024)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, key := range []string{"a", "a", "b", "c", "a"} {
+		if _, err := hc.Get(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hits, misses := hc.CacheStat()
+	if hits != 2 || misses != 3 {
+		t.Fatalf("hits %d, misses %d, expect 2 and 3", hits, misses)
+	}
+
+	if err := hc.Put("a", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := hc.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, []byte("new")) {
+		t.Fatalf("block a was not invalidated after put")
+	}
+
+	if err := hc.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := hc.Get("b"); err == nil {
+		t.Fatalf("block b was not invalidated after delete")
+	}
+}
+
+// pauseStore block Get until resume, after the data was read from store
+type pauseStore struct {
+	BlockStore
+	read   chan struct{}
+	resume chan struct{}
+}
+
+func (ps *pauseStore) Get(key string) ([]byte, error) {
+	data, err := ps.BlockStore.Get(key)
+	ps.read <- struct{}{}
+	<-ps.resume
+	return data, err
+}
+
+func TestHotCacheDeleteWhileGet(t *testing.T) {
+	fs := newFileStore(t.TempDir())
+	ps := &pauseStore{BlockStore: fs, read: make(chan struct{}), resume: make(chan struct{})}
+	hc := NewHotCache(ps, 8*1024)
+
+	if err := fs.Put("a", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := hc.Get("a")
+		done <- err
+	}()
+
+	// block is deleted after Get read it from store but before Get cache it
+	<-ps.read
+	if err := hc.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	close(ps.resume)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := hc.blocks["a"]; ok {
+		t.Fatal("deleted block should not be cached")
+	}
+}
@@ -0,0 +1,266 @@
+package blockstore
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/linguohua/titan/node/fsutil"
+)
+
+// multiStore spread blocks across several block stores, usually one per disk.
+// Paths should be on different mount points, otherwise the capacity of
+// the same file system will be counted more than once.
+type multiStore struct {
+	stores []BlockStore
+	// key => index of the store holding it, filled when block is written or found,
+	// so only the recorded store is checked on read
+	indexLock sync.RWMutex
+	index     map[string]int
+}
+
+// NewMultiBlockStore create a block store for every path,
+// if only one path, return the block store of the path directly
+func NewMultiBlockStore(paths []string, storeType string) BlockStore {
+	if len(paths) == 0 {
+		log.Fatalf("NewMultiBlockStore, paths is empty")
+	}
+
+	if len(paths) == 1 {
+		return NewBlockStore(paths[0], storeType)
+	}
+
+	ms := &multiStore{stores: make([]BlockStore, 0, len(paths)), index: make(map[string]int)}
+	for _, path := range paths {
+		ms.stores = append(ms.stores, NewBlockStore(path, storeType))
+	}
+
+	return ms
+}
+
+func (ms *multiStore) Type() string {
+	return "MultiStore"
+}
+
+// GetPath return the path of the first store
+func (ms *multiStore) GetPath() string {
+	return ms.stores[0].GetPath()
+}
+
+// Put overwrite the block if it already exist on one of stores,
+// else put it to the store with the most available space
+func (ms *multiStore) Put(key string, value []byte) error {
+	i, err := ms.findStore(key)
+	if err == datastore.ErrNotFound {
+		i, err = ms.selectStore(int64(len(value)))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = ms.stores[i].Put(key, value)
+	if err != nil {
+		return err
+	}
+
+	ms.setIndex(key, i)
+	return nil
+}
+
+// PutReader do not know the size of block, put it to the store with the most available space
+func (ms *multiStore) PutReader(key string, r io.Reader) (int64, error) {
+	i, err := ms.findStore(key)
+	if err == datastore.ErrNotFound {
+		i, err = ms.selectStore(0)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := ms.stores[i].PutReader(key, r)
+	if err != nil {
+		return n, err
+	}
+
+	ms.setIndex(key, i)
+	return n, nil
+}
+
+func (ms *multiStore) Get(key string) ([]byte, error) {
+	i, err := ms.findStore(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ms.stores[i].Get(key)
+}
+
+func (ms *multiStore) Delete(key string) error {
+	i, err := ms.findStore(key)
+	if err != nil {
+		return err
+	}
+
+	err = ms.stores[i].Delete(key)
+	if err != nil {
+		return err
+	}
+
+	ms.deleteIndex(key)
+	return nil
+}
+
+func (ms *multiStore) GetReader(key string) (BlockReader, error) {
+	i, err := ms.findStore(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ms.stores[i].GetReader(key)
+}
+
+func (ms *multiStore) Has(key string) (exists bool, err error) {
+	_, err = ms.findStore(key)
+	if err == nil {
+		return true, nil
+	}
+
+	if err == datastore.ErrNotFound {
+		return false, nil
+	}
+
+	return false, err
+}
+
+// Stat sum the stat of all stores
+func (ms *multiStore) Stat() (fsutil.FsStat, error) {
+	total := fsutil.FsStat{}
+	for _, store := range ms.stores {
+		stat, err := store.Stat()
+		if err != nil {
+			return fsutil.FsStat{}, err
+		}
+
+		total.Capacity += stat.Capacity
+		total.Available += stat.Available
+		total.FSAvailable += stat.FSAvailable
+		total.Reserved += stat.Reserved
+		total.Max += stat.Max
+		total.Used += stat.Used
+	}
+
+	return total, nil
+}
+
+func (ms *multiStore) KeyCount() (int, error) {
+	total := 0
+	for _, store := range ms.stores {
+		count, err := store.KeyCount()
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+
+	return total, nil
+}
+
+func (ms *multiStore) GetAllKeys() ([]string, error) {
+	keys := make([]string, 0)
+	for _, store := range ms.stores {
+		storeKeys, err := store.GetAllKeys()
+		if err != nil {
+			return []string{}, err
+		}
+		keys = append(keys, storeKeys...)
+	}
+
+	return keys, nil
+}
+
+// ForEachKey merge the keys of all stores in ascending order
+func (ms *multiStore) ForEachKey(f func(key string) error) error {
+	iterators := make([]keyIterator, 0, len(ms.stores))
+	for _, store := range ms.stores {
+		iterators = append(iterators, store.ForEachKey)
+	}
+
+	return mergeSortedKeys(iterators, f)
+}
+
+// findStore return the index of store holding the key, the indexed store is checked first,
+// all stores are checked only if the key is not indexed or moved
+func (ms *multiStore) findStore(key string) (int, error) {
+	ms.indexLock.RLock()
+	indexed, ok := ms.index[key]
+	ms.indexLock.RUnlock()
+
+	if ok {
+		exist, err := ms.stores[indexed].Has(key)
+		if err == nil && exist {
+			return indexed, nil
+		}
+		ms.deleteIndex(key)
+	}
+
+	for i, store := range ms.stores {
+		if ok && i == indexed {
+			continue
+		}
+
+		exist, err := store.Has(key)
+		if err != nil {
+			log.Errorf("findStore, path:%s, key:%s, err:%s", store.GetPath(), key, err.Error())
+			continue
+		}
+
+		if exist {
+			ms.setIndex(key, i)
+			return i, nil
+		}
+	}
+
+	return 0, datastore.ErrNotFound
+}
+
+func (ms *multiStore) setIndex(key string, i int) {
+	ms.indexLock.Lock()
+	defer ms.indexLock.Unlock()
+
+	ms.index[key] = i
+}
+
+func (ms *multiStore) deleteIndex(key string) {
+	ms.indexLock.Lock()
+	defer ms.indexLock.Unlock()
+
+	delete(ms.index, key)
+}
+
+// selectStore return the index of store with the most available space
+func (ms *multiStore) selectStore(size int64) (int, error) {
+	selected := -1
+	maxAvailable := int64(0)
+
+	for i, store := range ms.stores {
+		stat, err := store.Stat()
+		if err != nil {
+			log.Errorf("selectStore, path:%s, stat err:%s", store.GetPath(), err.Error())
+			continue
+		}
+
+		if stat.Available > maxAvailable {
+			maxAvailable = stat.Available
+			selected = i
+		}
+	}
+
+	if selected < 0 || maxAvailable < size {
+		return 0, fmt.Errorf("no disk space for block size %d, max available %d", size, maxAvailable)
+	}
+
+	return selected, nil
+}
@@ -0,0 +1,52 @@
+package blockstore
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+)
+
+func TestMultiStoreIndex(t *testing.T) {
+	dir := t.TempDir()
+	ms := NewMultiBlockStore([]string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}, "FileStore").(*multiStore)
+
+	if err := ms.Put("key", []byte("titan")); err != nil {
+		t.Fatal(err)
+	}
+
+	i, ok := ms.index["key"]
+	if !ok {
+		t.Fatal("store of written key is not indexed")
+	}
+
+	// block moved to the other store, it is found and indexed again
+	other := (i + 1) % len(ms.stores)
+	if err := ms.stores[i].Delete("key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.stores[other].Put("key", []byte("titan")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ms.Get("key")
+	if err != nil || string(data) != "titan" {
+		t.Fatalf("get moved key %s, error %v", string(data), err)
+	}
+
+	if ms.index["key"] != other {
+		t.Fatalf("moved key indexed to store %d, expect %d", ms.index["key"], other)
+	}
+
+	if err := ms.Delete("key"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := ms.index["key"]; ok {
+		t.Fatal("deleted key is still indexed")
+	}
+
+	if _, err := ms.Get("key"); err != datastore.ErrNotFound {
+		t.Fatalf("get deleted key error %v, expect not found", err)
+	}
+}
@@ -0,0 +1,153 @@
+package blockstore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+var errMergeStopped = errors.New("merge stopped")
+
+// keyIterator iterate keys in ascending order, stop if f return error
+type keyIterator func(f func(key string) error) error
+
+// mergeSortedKeys merge the keys of iterators in ascending order, the same key of iterators is only called once
+func mergeSortedKeys(iterators []keyIterator, f func(key string) error) error {
+	type source struct {
+		keys chan string
+		errc chan error
+		key  string
+		ok   bool
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	sources := make([]*source, 0, len(iterators))
+	for _, iterate := range iterators {
+		s := &source{keys: make(chan string, readNamesBatch), errc: make(chan error, 1)}
+		sources = append(sources, s)
+
+		go func(iterate keyIterator) {
+			err := iterate(func(key string) error {
+				select {
+				case s.keys <- key:
+					return nil
+				case <-done:
+					return errMergeStopped
+				}
+			})
+			close(s.keys)
+			s.errc <- err
+		}(iterate)
+	}
+
+	next := func(s *source) error {
+		s.key, s.ok = <-s.keys
+		if s.ok {
+			return nil
+		}
+
+		err := <-s.errc
+		if err == errMergeStopped {
+			return nil
+		}
+		return err
+	}
+
+	for _, s := range sources {
+		if err := next(s); err != nil {
+			return err
+		}
+	}
+
+	last := ""
+	for {
+		var min *source
+		for _, s := range sources {
+			if s.ok && (min == nil || s.key < min.key) {
+				min = s
+			}
+		}
+
+		if min == nil {
+			return nil
+		}
+
+		if min.key != last || last == "" {
+			last = min.key
+			if err := f(min.key); err != nil {
+				return err
+			}
+		}
+
+		if err := next(min); err != nil {
+			return err
+		}
+	}
+}
+
+// sortedKeysRun write sorted keys to a temp file in dir, one key per line
+func sortedKeysRun(dir string, keys []string) (string, error) {
+	sort.Strings(keys)
+
+	file, err := os.CreateTemp(dir, tmpFilePrefix+"keys-*")
+	if err != nil {
+		return "", err
+	}
+
+	w := bufio.NewWriter(file)
+	for _, key := range keys {
+		if _, err = fmt.Fprintln(w, key); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		err = w.Flush()
+	}
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(file.Name()) //nolint:errcheck
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+func runIterator(path string) keyIterator {
+	return func(f func(key string) error) error {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close() //nolint:errcheck
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if err = f(scanner.Text()); err != nil {
+				return err
+			}
+		}
+
+		return scanner.Err()
+	}
+}
+
+func sliceIterator(keys []string) keyIterator {
+	return func(f func(key string) error) error {
+		for _, key := range keys {
+			if err := f(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
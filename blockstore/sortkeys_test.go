@@ -0,0 +1,79 @@
+package blockstore
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func collectKeys(t *testing.T, iterate keyIterator) []string {
+	keys := make([]string, 0)
+	err := iterate(func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keys
+}
+
+func TestForEachKeyInOrder(t *testing.T) {
+	dir := t.TempDir()
+	ms := NewMultiBlockStore([]string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}, "FileStore").(*multiStore)
+
+	expect := make([]string, 0)
+	for _, i := range rand.Perm(100) {
+		key := fmt.Sprintf("key%03d", i)
+		if err := ms.stores[i%2].Put(key, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+		expect = append(expect, key)
+	}
+	sort.Strings(expect)
+
+	keys := collectKeys(t, ms.ForEachKey)
+	if fmt.Sprint(keys) != fmt.Sprint(expect) {
+		t.Fatalf("keys not in order: %v", keys)
+	}
+
+	// stop iterate
+	errStop := errors.New("stop")
+	count := 0
+	err := ms.ForEachKey(func(key string) error {
+		count++
+		if count == 10 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop || count != 10 {
+		t.Fatalf("stop iterate error %v, count %d", err, count)
+	}
+}
+
+func TestMergeSortedRuns(t *testing.T) {
+	dir := t.TempDir()
+
+	runA, err := sortedKeysRun(dir, []string{"d", "a", "f"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runB, err := sortedKeysRun(dir, []string{"e", "b", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := collectKeys(t, func(f func(key string) error) error {
+		return mergeSortedKeys([]keyIterator{runIterator(runA), runIterator(runB), sliceIterator([]string{"c", "g"})}, f)
+	})
+
+	if fmt.Sprint(keys) != fmt.Sprint([]string{"a", "b", "c", "d", "e", "f", "g"}) {
+		t.Fatalf("merge keys %v", keys)
+	}
+}
@@ -0,0 +1,119 @@
+package blockstore
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+
+	mh "github.com/multiformats/go-multihash"
+)
+
+// ErrBlockCorrupted block data does not match the hash of key
+var ErrBlockCorrupted = errors.New("block data does not match hash")
+
+// CorruptNotifier implement by block store which can find corrupt blocks
+type CorruptNotifier interface {
+	// handler will be call with the key of corrupt block, after the block was quarantined
+	SetCorruptHandler(handler func(key string))
+}
+
+// VerifyStore check every block read from store with the multihash of key,
+// corrupt block will move to quarantine store and return ErrBlockCorrupted
+type VerifyStore struct {
+	BlockStore
+	quarantine     BlockStore
+	corruptHandler func(key string)
+}
+
+func NewVerifyBlockStore(bs BlockStore, quarantinePath string) *VerifyStore {
+	err := os.MkdirAll(quarantinePath, 0o755)
+	if err != nil {
+		log.Fatalf("NewVerifyBlockStore, path:%s, err:%s", quarantinePath, err.Error())
+	}
+
+	return &VerifyStore{BlockStore: bs, quarantine: &fileStore{Path: quarantinePath}}
+}
+
+func (vs *VerifyStore) SetCorruptHandler(handler func(key string)) {
+	vs.corruptHandler = handler
+}
+
+func (vs *VerifyStore) Get(key string) ([]byte, error) {
+	data, err := vs.BlockStore.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = vs.verify(key, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// GetReader have to read the whole block to verify it before return
+func (vs *VerifyStore) GetReader(key string) (BlockReader, error) {
+	reader, err := vs.BlockStore.GetReader(key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	err = vs.verify(key, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bytesReader{bytes.NewReader(data)}, nil
+}
+
+func (vs *VerifyStore) verify(key string, data []byte) error {
+	multihash, err := mh.FromHexString(key)
+	if err != nil {
+		// key is not a multihash, can not verify
+		return nil
+	}
+
+	decoded, err := mh.Decode(multihash)
+	if err != nil {
+		return nil
+	}
+
+	sum, err := mh.Sum(data, decoded.Code, decoded.Length)
+	if err != nil {
+		log.Warnf("verify block %s, sum error:%s", key, err.Error())
+		return nil
+	}
+
+	if bytes.Equal(sum, multihash) {
+		return nil
+	}
+
+	log.Errorf("block %s was corrupted, size:%d, move to quarantine", key, len(data))
+	vs.quarantineBlock(key, data)
+
+	return ErrBlockCorrupted
+}
+
+func (vs *VerifyStore) quarantineBlock(key string, data []byte) {
+	err := vs.quarantine.Put(key, data)
+	if err != nil {
+		log.Errorf("quarantine block %s error:%s", key, err.Error())
+	}
+
+	err = vs.BlockStore.Delete(key)
+	if err != nil {
+		log.Errorf("delete corrupt block %s error:%s", key, err.Error())
+	}
+
+	if vs.corruptHandler != nil {
+		go vs.corruptHandler(key)
+	}
+}
@@ -3,11 +3,13 @@ package cli
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"time"
 
 	"github.com/linguohua/titan/api"
 	API "github.com/linguohua/titan/api"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
 )
 
 var EdgeCmds = []*cli.Command{
@@ -19,6 +21,8 @@ var EdgeCmds = []*cli.Command{
 	CacheStatCmd,
 	StoreKeyCmd,
 	DeleteAllBlocksCmd,
+	ImportCarfileCmd,
+	ExportCarfileCmd,
 	testSyncCmd,
 }
 
@@ -240,7 +244,7 @@ var CacheStatCmd = &cli.Command{
 			return err
 		}
 
-		fmt.Printf("Cache block count %d, Wait cache count %d, Caching count %d", stat.CacheBlockCount, stat.WaitCacheBlockNum, stat.DoingCacheBlockNum)
+		fmt.Printf("Cache block count %d, Wait cache count %d, Caching count %d, Hot cache hits %d, Hot cache misses %d", stat.CacheBlockCount, stat.WaitCacheBlockNum, stat.DoingCacheBlockNum, stat.HotCacheHits, stat.HotCacheMisses)
 		return nil
 	},
 }
@@ -309,6 +313,109 @@ var DeleteAllBlocksCmd = &cli.Command{
 	},
 }
 
+var ImportCarfileCmd = &cli.Command{
+	Name:  "import",
+	Usage: "import car file or directory, and report to scheduler as a cache of carfile",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "path",
+			Usage: "path of CARv1/CARv2 file or directory",
+			Value: "",
+		},
+		&cli.StringFlag{
+			Name:  "expired-date",
+			Usage: "the cache expired date, example: --expired-date=2022-1-1 00:00:00, default 7 days later",
+			Value: "",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		path := cctx.String("path")
+		if path == "" {
+			return xerrors.New("path is nil")
+		}
+
+		// path is opened by node
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+
+		expiredDate := cctx.String("expired-date")
+		if expiredDate == "" {
+			expiredDate = time.Now().Add(time.Duration(7*24) * time.Hour).Format("2006-1-2 15:04:05")
+		}
+
+		expiredTime, err := time.ParseInLocation("2006-1-2 15:04:05", expiredDate, time.Local)
+		if err != nil {
+			return xerrors.Errorf("expired date err:%s", err.Error())
+		}
+
+		api, closer, err := GetEdgeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := ReqContext(cctx)
+		result, err := api.ImportCarfile(ctx, path, expiredTime)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("import carfile %s, cache id %s, blocks %d, size %d\n", result.CarfileCid, result.CacheID, result.Blocks, result.TotalSize)
+		return nil
+	},
+}
+
+var ExportCarfileCmd = &cli.Command{
+	Name:  "export",
+	Usage: "export carfile in block store to CARv1 file",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "cid",
+			Usage: "carfile cid",
+			Value: "",
+		},
+		&cli.StringFlag{
+			Name:  "path",
+			Usage: "path of CARv1 file, file must not exist",
+			Value: "",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		cid := cctx.String("cid")
+		if cid == "" {
+			return xerrors.New("cid is nil")
+		}
+
+		path := cctx.String("path")
+		if path == "" {
+			return xerrors.New("path is nil")
+		}
+
+		// path is opened by node
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+
+		api, closer, err := GetEdgeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := ReqContext(cctx)
+		result, err := api.ExportCarfile(ctx, cid, path)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("export carfile %s to %s, blocks %d, size %d\n", result.CarfileCid, path, result.Blocks, result.TotalSize)
+		return nil
+	},
+}
+
 var testSyncCmd = &cli.Command{
 	Name:  "sync",
 	Usage: "data sync",
@@ -316,6 +423,42 @@ var testSyncCmd = &cli.Command{
 		checksum,
 		checksumInRange,
 		scrubBlocks,
+		reconcileCmd,
+	},
+}
+
+var reconcileCmd = &cli.Command{
+	Name:  "reconcile",
+	Usage: "reconcile block store with fid, remove orphan blocks and refetch missing blocks",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "only report what to repair, example: --dry-run=true",
+			Value: false,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetEdgeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := ReqContext(cctx)
+		report, err := api.Reconcile(ctx, cctx.Bool("dry-run"))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Dry run %v, fid %d, block %d, orphan %d, missing %d, fixed keys %d, cost %s\n",
+			report.DryRun, report.FidCount, report.BlockCount, report.OrphanBlocks, report.MissingBlocks, report.FixedKeys, report.EndTime.Sub(report.StartTime))
+		for _, cid := range report.OrphanCids {
+			fmt.Printf("orphan %s\n", cid)
+		}
+		for _, cid := range report.RefetchCids {
+			fmt.Printf("refetch %s\n", cid)
+		}
+		return nil
 	},
 }
 
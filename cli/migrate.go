@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/linguohua/titan/blockstore"
+	"github.com/linguohua/titan/node/repo"
+	"github.com/linguohua/titan/node/secret"
+	datasync "github.com/linguohua/titan/node/sync"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+// MigrateBlockStoreCmd copy blocks of edge or candidate to another block store, nodeName is edge or candidate,
+// repoFlag is the flag of node repo
+func MigrateBlockStoreCmd(nodeName, repoFlag string) *cli.Command {
+	return &cli.Command{
+		Name:  "migrate-blockstore",
+		Usage: fmt.Sprintf("Copy all blocks to another block store, %s must be stopped", nodeName),
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "from-path",
+				Usage:    fmt.Sprintf("source block store path, multiple disks separated by comma, example: --from-path=./%s-blockstore", nodeName),
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "from-type",
+				Usage: "source block store type is FileStore or Badger, example: --from-type=FileStore",
+				Value: "FileStore",
+			},
+			&cli.BoolFlag{
+				Name:  "from-encrypt",
+				Usage: "source blocks were encrypted, example: --from-encrypt=true",
+			},
+			&cli.BoolFlag{
+				Name:  "from-compress",
+				Usage: "source blocks were compressed, example: --from-compress=true",
+			},
+			&cli.StringFlag{
+				Name:     "to-path",
+				Usage:    fmt.Sprintf("target block store path, multiple disks separated by comma, example: --to-path=./%s-badger", nodeName),
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "to-type",
+				Usage: "target block store type is FileStore or Badger, example: --to-type=Badger",
+				Value: "Badger",
+			},
+			&cli.BoolFlag{
+				Name:  "to-encrypt",
+				Usage: "encrypt blocks in target store, example: --to-encrypt=true",
+			},
+			&cli.BoolFlag{
+				Name:  "to-compress",
+				Usage: "compress blocks in target store, example: --to-compress=true",
+			},
+		},
+		Action: func(cctx *cli.Context) error {
+			if cctx.String("from-path") == cctx.String("to-path") {
+				return xerrors.Errorf("from-path and to-path can not be the same")
+			}
+
+			r, err := repo.NewFS(cctx.String(repoFlag))
+			if err != nil {
+				return err
+			}
+
+			// lock repo to make sure node is not running
+			lr, err := r.Lock(repo.Worker)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err := lr.Close(); err != nil {
+					log.Error("closing repo", err)
+				}
+			}()
+
+			ds, err := lr.Datastore(context.Background(), "/metadata")
+			if err != nil {
+				return err
+			}
+
+			from, err := openMigrateBlockStore(lr, cctx.String("from-path"), cctx.String("from-type"), cctx.Bool("from-encrypt"), cctx.Bool("from-compress"))
+			if err != nil {
+				return err
+			}
+
+			to, err := openMigrateBlockStore(lr, cctx.String("to-path"), cctx.String("to-type"), cctx.Bool("to-encrypt"), cctx.Bool("to-compress"))
+			if err != nil {
+				return err
+			}
+
+			stat, err := datasync.MigrateBlockStore(ReqContext(cctx), ds, from, to, func(stat datasync.MigrateStat) {
+				fmt.Printf("progress %d/%d, migrated %d, skipped %d, missing %d, failed %d\n",
+					stat.Skipped+stat.Migrated+stat.Missing+stat.Failed, stat.Total, stat.Migrated, stat.Skipped, stat.Missing, stat.Failed)
+			})
+			if err != nil {
+				return xerrors.Errorf("migrate block store: %w, run the command again to resume", err)
+			}
+
+			fmt.Printf("migrate complete, total %d, migrated %d, missing %d\n", stat.Total, stat.Migrated+stat.Skipped, stat.Missing)
+			fmt.Printf("start %s with --blockstore-path=%s --blockstore-type=%s to use the new block store\n", nodeName, cctx.String("to-path"), cctx.String("to-type"))
+			return nil
+		},
+	}
+}
+
+func openMigrateBlockStore(lr repo.LockedRepo, path, storeType string, encrypt, compress bool) (blockstore.BlockStore, error) {
+	bs := blockstore.NewMultiBlockStore(strings.Split(path, ","), storeType)
+	if encrypt {
+		key, err := secret.BlockStoreKey(lr)
+		if err != nil {
+			return nil, err
+		}
+		bs = blockstore.NewEncryptBlockStore(bs, key)
+	}
+	if compress {
+		bs = blockstore.NewCompressBlockStore(bs)
+	}
+
+	return bs, nil
+}
@@ -91,6 +91,12 @@ var (
 		Value: 2,
 	}
 
+	priorityFlag = &cli.IntFlag{
+		Name:  "priority",
+		Usage: "carfile with higher priority is cached first (default:0)",
+		Value: 0,
+	}
+
 	nodeTypeFlag = &cli.IntFlag{
 		Name:  "node-type",
 		Usage: "node type 1:Edge 2:Candidate 3:Scheduler",
@@ -720,6 +726,8 @@ var showDataInfoCmd = &cli.Command{
 				return "done"
 			case api.CacheStatusTimeout:
 				return "time out"
+			case api.CacheStatusCancel:
+				return "cancelled"
 			default:
 				return "failed"
 			}
@@ -747,6 +755,7 @@ var cacheCarfileCmd = &cli.Command{
 		// schedulerURLFlag,
 		cidFlag,
 		reliabilityFlag,
+		priorityFlag,
 		expiredDateFlag,
 	},
 
@@ -783,7 +792,7 @@ var cacheCarfileCmd = &cli.Command{
 			return xerrors.Errorf("expired date err:%s", err.Error())
 		}
 
-		err = schedulerAPI.CacheCarfile(ctx, cid, reliability, time)
+		err = schedulerAPI.CacheCarfile(ctx, cid, reliability, cctx.Int("priority"), time)
 		if err != nil {
 			return err
 		}
@@ -959,7 +968,13 @@ var cachingBlocksCmd = &cli.Command{
 			return err
 		}
 
-		fmt.Printf("caching blocks:%v", body)
+		for _, stat := range body.List {
+			if stat.Worker == api.CachingWorkerWaiting {
+				fmt.Printf("waiting cid:%s\n", stat.Cid)
+				continue
+			}
+			fmt.Printf("worker %d cid:%s percent:%.0f cost:%dms\n", stat.Worker, stat.Cid, stat.DownloadPercent, stat.CostTime)
+		}
 
 		return nil
 	},
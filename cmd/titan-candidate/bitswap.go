@@ -0,0 +1,17 @@
+//go:build bitswap
+// +build bitswap
+
+package main
+
+import (
+	"context"
+
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/linguohua/titan/lib/p2p"
+)
+
+// bootstrapBitswap connect to peers and return the bitswap exchange to load blocks
+func bootstrapBitswap(ctx context.Context, peers []peer.AddrInfo) (exchange.Interface, error) {
+	return p2p.Bootstrap(ctx, peers)
+}
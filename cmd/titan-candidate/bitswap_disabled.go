@@ -0,0 +1,18 @@
+//go:build !bitswap
+// +build !bitswap
+
+package main
+
+import (
+	"context"
+
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+)
+
+// bootstrapBitswap the libp2p transports of bitswap can not be built with every go release,
+// so bitswap is only included when building with -tags bitswap
+func bootstrapBitswap(ctx context.Context, peers []peer.AddrInfo) (exchange.Interface, error) {
+	return nil, xerrors.New("titan-candidate is built without bitswap, rebuild with -tags bitswap")
+}
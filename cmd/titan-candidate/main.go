@@ -22,12 +22,15 @@ import (
 	"github.com/linguohua/titan/lib/ulimit"
 	"github.com/linguohua/titan/metrics"
 	"github.com/linguohua/titan/node/device"
+	"github.com/linguohua/titan/node/download"
 	"github.com/linguohua/titan/node/helper"
 	"github.com/linguohua/titan/node/repo"
+	"github.com/linguohua/titan/node/secret"
 	"github.com/shirou/gopsutil/v3/cpu"
 
 	"github.com/google/uuid"
 	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/urfave/cli/v2"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
@@ -52,6 +55,7 @@ func main() {
 
 	local := []*cli.Command{
 		runCmd,
+		lcli.MigrateBlockStoreCmd("candidate", FlagWorkerRepo),
 	}
 
 	local = append(local, lcli.CommonCommands...)
@@ -121,14 +125,59 @@ var runCmd = &cli.Command{
 		},
 		&cli.StringFlag{
 			Name:  "blockstore-path",
-			Usage: "block store path, example: --blockstore-path=./blockstore",
+			Usage: "block store path, multiple disks separated by comma, example: --blockstore-path=./blockstore or --blockstore-path=/mnt/disk1,/mnt/disk2",
 			Value: "./candidate-blockstore", // should follow --repo default
 		},
 		&cli.StringFlag{
 			Name:  "blockstore-type",
-			Usage: "block store type is FileStore or RocksDB, example: --blockstore-type=FileStore",
+			Usage: "block store type is FileStore or Badger, example: --blockstore-type=FileStore",
 			Value: "FileStore", // should follow --repo default
 		},
+		&cli.BoolFlag{
+			Name:  "blockstore-encrypt",
+			Usage: "encrypt block with the key in repo keystore, existing blocks have to be migrated first, example: --blockstore-encrypt=true",
+			Value: false,
+		},
+		&cli.BoolFlag{
+			Name:  "blockstore-compress",
+			Usage: "compress block with zstd if it can save space, example: --blockstore-compress=true",
+			Value: false,
+		},
+		&cli.BoolFlag{
+			Name:  "blockstore-verify",
+			Usage: "verify block hash on read, corrupt block will move to quarantine in repo, example: --blockstore-verify=true",
+			Value: false,
+		},
+		&cli.Int64Flag{
+			Name:  "blockstore-quota",
+			Usage: "max size of block store, unit is byte, 0 means no limit, example set 100GB: --blockstore-quota=107374182400",
+			Value: 0,
+		},
+		&cli.StringFlag{
+			Name:  "evict-policy",
+			Usage: "evict blocks when block store quota is reached, lru or reliability, example: --evict-policy=lru",
+			Value: "lru",
+		},
+		&cli.IntFlag{
+			Name:  "loader-workers",
+			Usage: "number of workers load blocks concurrently, example: --loader-workers=3",
+			Value: 3,
+		},
+		&cli.DurationFlag{
+			Name:  "reconcile-interval",
+			Usage: "reconcile block store with fid periodically, 0 means only reconcile at start, example: --reconcile-interval=24h",
+			Value: 24 * time.Hour,
+		},
+		&cli.IntFlag{
+			Name:  "reconcile-rate",
+			Usage: "max keys checked per second by reconcile, 0 means no limit, example: --reconcile-rate=1000",
+			Value: 1000,
+		},
+		&cli.Int64Flag{
+			Name:  "hot-cache-size",
+			Usage: "max size of in-memory block cache for download server, unit is byte, 0 means disable, example set 256MB: --hot-cache-size=268435456",
+			Value: 0,
+		},
 		&cli.StringFlag{
 			Name:  "download-srv-key",
 			Usage: "download server key for who download block, example: --download-srv-key=KK20FeKPsE3qwQgR",
@@ -139,6 +188,19 @@ var runCmd = &cli.Command{
 			Usage: "download server address for who download block, example: --download-srv-addr=192.168.0.136:3000",
 			Value: "0.0.0.0:3000", // should follow --repo default
 		},
+		&cli.BoolFlag{
+			Name:  "download-srv-tls",
+			Usage: "serve download server with https, a self-signed certificate is generated in repo if --download-srv-cert is not set",
+			Value: false,
+		},
+		&cli.StringFlag{
+			Name:  "download-srv-cert",
+			Usage: "certificate file of https download server, example: --download-srv-cert=/path/to/cert.pem",
+		},
+		&cli.StringFlag{
+			Name:  "download-srv-cert-key",
+			Usage: "key file of certificate of https download server, example: --download-srv-cert-key=/path/to/key.pem",
+		},
 		&cli.Int64Flag{
 			Name:  "bandwidth-up",
 			Usage: "upload file bandwidth, unit is B/s example set 100MB/s: --bandwidth-up=104857600",
@@ -166,6 +228,11 @@ var runCmd = &cli.Command{
 			Usage:   "ipfs api url",
 			Value:   "http://127.0.0.1:5001",
 		},
+		&cli.StringFlag{
+			Name:  "bitswap-peers",
+			Usage: "load blocks from these peers with bitswap instead of ipfs api, multiaddr split by comma, example: --bitswap-peers=/ip4/192.168.0.136/tcp/4001/p2p/12D3KooW...",
+			Value: "",
+		},
 		&cli.BoolFlag{
 			Name:  "locator",
 			Usage: "connect to locator get scheduler url",
@@ -320,7 +387,21 @@ var runCmd = &cli.Command{
 			return err
 		}
 
-		blockStore := blockstore.NewBlockStore(cctx.String("blockstore-path"), cctx.String("blockstore-type"))
+		blockStore := blockstore.NewMultiBlockStore(strings.Split(cctx.String("blockstore-path"), ","), cctx.String("blockstore-type"))
+		if cctx.Bool("blockstore-encrypt") {
+			key, err := secret.BlockStoreKey(lr)
+			if err != nil {
+				return err
+			}
+			blockStore = blockstore.NewEncryptBlockStore(blockStore, key)
+		}
+		if cctx.Bool("blockstore-compress") {
+			blockStore = blockstore.NewCompressBlockStore(blockStore)
+		}
+		if cctx.Bool("blockstore-verify") {
+			blockStore = blockstore.NewVerifyBlockStore(blockStore, filepath.Join(lr.Path(), "quarantine"))
+		}
+
 		device := device.NewDevice(
 			deviceID,
 			externalIP,
@@ -330,15 +411,49 @@ var runCmd = &cli.Command{
 			blockStore)
 
 		nodeParams := &helper.NodeParams{
-			DS:              ds,
-			Scheduler:       schedulerAPI,
-			BlockStore:      blockStore,
-			DownloadSrvKey:  cctx.String("download-srv-key"),
-			DownloadSrvAddr: cctx.String("download-srv-addr"),
-			IPFSAPI:         cctx.String("ipfs-api"),
+			DS:                ds,
+			Scheduler:         schedulerAPI,
+			BlockStore:        blockStore,
+			DownloadSrvKey:    cctx.String("download-srv-key"),
+			DownloadSrvAddr:   cctx.String("download-srv-addr"),
+			IPFSAPI:           cctx.String("ipfs-api"),
+			StorageQuota:      cctx.Int64("blockstore-quota"),
+			EvictPolicy:       cctx.String("evict-policy"),
+			HotCacheSize:      cctx.Int64("hot-cache-size"),
+			ReconcileInterval: cctx.Duration("reconcile-interval"),
+			ReconcileRate:     cctx.Int("reconcile-rate"),
+			LoaderWorkers:     cctx.Int("loader-workers"),
+			PartialBlockDir:   filepath.Join(lr.Path(), "partial-blocks"),
+		}
+
+		nodeParams.DownloadSrvCertFile = cctx.String("download-srv-cert")
+		nodeParams.DownloadSrvKeyFile = cctx.String("download-srv-cert-key")
+		if cctx.Bool("download-srv-tls") && nodeParams.DownloadSrvCertFile == "" {
+			nodeParams.DownloadSrvCertFile, nodeParams.DownloadSrvKeyFile, err = download.SelfSignedCertFiles(lr.Path(), []string{externalIP, internalIP})
+			if err != nil {
+				return xerrors.Errorf("generate self-signed certificate of download server: %w", err)
+			}
 		}
 
-		log.Info("ipfs-api " + nodeParams.IPFSAPI)
+		if cctx.String("bitswap-peers") != "" {
+			peers := make([]peer.AddrInfo, 0)
+			for _, addr := range strings.Split(cctx.String("bitswap-peers"), ",") {
+				info, err := peer.AddrInfoFromString(addr)
+				if err != nil {
+					return xerrors.Errorf("parse bitswap peer %s: %w", addr, err)
+				}
+				peers = append(peers, *info)
+			}
+
+			exchange, err := bootstrapBitswap(ctx, peers)
+			if err != nil {
+				return xerrors.Errorf("bootstrap bitswap: %w", err)
+			}
+			nodeParams.Exchange = exchange
+			log.Infof("bitswap peers %s", cctx.String("bitswap-peers"))
+		} else {
+			log.Info("ipfs-api " + nodeParams.IPFSAPI)
+		}
 		tcpSrvAddr := cctx.String("tcp-srv-addr")
 
 		candidateApi := candidate.NewLocalCandidateNode(context.Background(), tcpSrvAddr, device, nodeParams)
@@ -375,6 +490,7 @@ var runCmd = &cli.Command{
 
 		candidate := candidateApi.(*candidate.Candidate)
 		downloadSrvURL := candidate.GetDownloadSrvURL()
+		certFingerprint := candidate.GetDownloadSrvCertFingerprint()
 
 		minerSession, err := getSchedulerSession(schedulerAPI, deviceID)
 		if err != nil {
@@ -429,10 +545,17 @@ var runCmd = &cli.Command{
 							cancel()
 							return
 						}
+						if certFingerprint != "" {
+							err = downloadSrvCertFingerprint(schedulerAPI, certFingerprint)
+							if err != nil {
+								log.Errorf("register certificate fingerprint error:%s", err.Error())
+							}
+						}
 						err = candidate.LoadPublicKey()
 						if err != nil {
 							log.Errorf("LoadPublicKey error:%s", err.Error())
 						}
+						candidate.ReportCacheQueue()
 
 						log.Info("Candidate registered successfully, waiting for tasks")
 						errCount = 0
@@ -451,6 +574,12 @@ var runCmd = &cli.Command{
 	},
 }
 
+func downloadSrvCertFingerprint(api api.Scheduler, fingerprint string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), helper.SchedulerApiTimeout*time.Second)
+	defer cancel()
+	return api.NodeDownloadSrvCertFingerprint(ctx, fingerprint)
+}
+
 func candidateNodeConnect(api api.Scheduler, rpcURL string, downloadSrvURL string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), helper.SchedulerApiTimeout*time.Second)
 	defer cancel()
@@ -5,7 +5,9 @@ import (
 	"net/http"
 
 	"github.com/linguohua/titan/lib/rpcenc"
+	"github.com/linguohua/titan/node/candidate"
 	"github.com/linguohua/titan/node/handler"
+	"github.com/linguohua/titan/node/helper"
 
 	"github.com/linguohua/titan/api"
 	"github.com/linguohua/titan/metrics/proxy"
@@ -15,12 +17,13 @@ import (
 	"github.com/gorilla/mux"
 )
 
-// func blockDownload(a api.Candidate) http.HandlerFunc {
-// 	return func(w http.ResponseWriter, r *http.Request) {
-// 		api := a.(candidate.CandidateAPI)
-// 		api.GetBlock(w, r)
-// 	}
-// }
+// blockDownload serve block to the edges which load block from this candidate, permission of rpc token is checked by ServeBlock
+func blockDownload(a api.Candidate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		api := a.(*candidate.Candidate)
+		api.ServeBlock(w, r)
+	}
+}
 
 func WorkerHandler(authv func(ctx context.Context, token string) ([]auth.Permission, error), a api.Candidate, permissioned bool) http.Handler {
 	mux := mux.NewRouter()
@@ -35,7 +38,7 @@ func WorkerHandler(authv func(ctx context.Context, token string) ([]auth.Permiss
 	rpcServer.Register("titan", wapi)
 
 	mux.Handle("/rpc/v0", rpcServer)
-	// mux.Handle("/rpc/v0/block/get", blockDownload(a))
+	mux.Handle("/rpc/v0"+helper.DownloadSrvPath, blockDownload(a))
 	mux.Handle("/rpc/streams/v0/push/{uuid}", readerHandler)
 	mux.PathPrefix("/").Handler(http.DefaultServeMux) // pprof
 
@@ -23,8 +23,10 @@ import (
 	"github.com/linguohua/titan/lib/ulimit"
 	"github.com/linguohua/titan/metrics"
 	"github.com/linguohua/titan/node/device"
+	"github.com/linguohua/titan/node/download"
 	"github.com/linguohua/titan/node/helper"
 	"github.com/linguohua/titan/node/repo"
+	"github.com/linguohua/titan/node/secret"
 	"github.com/shirou/gopsutil/v3/cpu"
 
 	"github.com/google/uuid"
@@ -52,6 +54,7 @@ func main() {
 
 	local := []*cli.Command{
 		runCmd,
+		lcli.MigrateBlockStoreCmd("edge", FlagWorkerRepo),
 	}
 
 	local = append(local, lcli.CommonCommands...)
@@ -121,14 +124,59 @@ var runCmd = &cli.Command{
 		},
 		&cli.StringFlag{
 			Name:  "blockstore-path",
-			Usage: "block store path, example: --blockstore-path=./blockstore",
+			Usage: "block store path, multiple disks separated by comma, example: --blockstore-path=./blockstore or --blockstore-path=/mnt/disk1,/mnt/disk2",
 			Value: "./edge-blockstore", // should follow --repo default
 		},
 		&cli.StringFlag{
 			Name:  "blockstore-type",
-			Usage: "block store type is FileStore or RocksDB, example: --blockstore-type=FileStore",
+			Usage: "block store type is FileStore or Badger, example: --blockstore-type=FileStore",
 			Value: "FileStore", // should follow --repo default
 		},
+		&cli.BoolFlag{
+			Name:  "blockstore-encrypt",
+			Usage: "encrypt block with the key in repo keystore, existing blocks have to be migrated first, example: --blockstore-encrypt=true",
+			Value: false,
+		},
+		&cli.BoolFlag{
+			Name:  "blockstore-compress",
+			Usage: "compress block with zstd if it can save space, example: --blockstore-compress=true",
+			Value: false,
+		},
+		&cli.BoolFlag{
+			Name:  "blockstore-verify",
+			Usage: "verify block hash on read, corrupt block will move to quarantine in repo, example: --blockstore-verify=true",
+			Value: false,
+		},
+		&cli.Int64Flag{
+			Name:  "blockstore-quota",
+			Usage: "max size of block store, unit is byte, 0 means no limit, example set 100GB: --blockstore-quota=107374182400",
+			Value: 0,
+		},
+		&cli.StringFlag{
+			Name:  "evict-policy",
+			Usage: "evict blocks when block store quota is reached, lru or reliability, example: --evict-policy=lru",
+			Value: "lru",
+		},
+		&cli.IntFlag{
+			Name:  "loader-workers",
+			Usage: "number of workers load blocks concurrently, example: --loader-workers=3",
+			Value: 3,
+		},
+		&cli.DurationFlag{
+			Name:  "reconcile-interval",
+			Usage: "reconcile block store with fid periodically, 0 means only reconcile at start, example: --reconcile-interval=24h",
+			Value: 24 * time.Hour,
+		},
+		&cli.IntFlag{
+			Name:  "reconcile-rate",
+			Usage: "max keys checked per second by reconcile, 0 means no limit, example: --reconcile-rate=1000",
+			Value: 1000,
+		},
+		&cli.Int64Flag{
+			Name:  "hot-cache-size",
+			Usage: "max size of in-memory block cache for download server, unit is byte, 0 means disable, example set 256MB: --hot-cache-size=268435456",
+			Value: 0,
+		},
 		&cli.StringFlag{
 			Name:  "download-srv-key",
 			Usage: "download server key for who download block, example: --download-srv-key=KK20FeKPsE3qwQgR",
@@ -139,6 +187,19 @@ var runCmd = &cli.Command{
 			Usage: "download server address for who download block, example: --download-srv-addr=192.168.0.136:3000",
 			Value: "0.0.0.0:3000", // should follow --repo default
 		},
+		&cli.BoolFlag{
+			Name:  "download-srv-tls",
+			Usage: "serve download server with https, a self-signed certificate is generated in repo if --download-srv-cert is not set",
+			Value: false,
+		},
+		&cli.StringFlag{
+			Name:  "download-srv-cert",
+			Usage: "certificate file of https download server, example: --download-srv-cert=/path/to/cert.pem",
+		},
+		&cli.StringFlag{
+			Name:  "download-srv-cert-key",
+			Usage: "key file of certificate of https download server, example: --download-srv-cert-key=/path/to/key.pem",
+		},
 		&cli.StringFlag{
 			Name:  "bandwidth-up",
 			Usage: "upload file bandwidth, unit is B/s example set 100MB/s: --bandwidth-up=104857600",
@@ -315,7 +376,20 @@ var runCmd = &cli.Command{
 			return err
 		}
 
-		blockStore := blockstore.NewBlockStore(cctx.String("blockstore-path"), cctx.String("blockstore-type"))
+		blockStore := blockstore.NewMultiBlockStore(strings.Split(cctx.String("blockstore-path"), ","), cctx.String("blockstore-type"))
+		if cctx.Bool("blockstore-encrypt") {
+			key, err := secret.BlockStoreKey(lr)
+			if err != nil {
+				return err
+			}
+			blockStore = blockstore.NewEncryptBlockStore(blockStore, key)
+		}
+		if cctx.Bool("blockstore-compress") {
+			blockStore = blockstore.NewCompressBlockStore(blockStore)
+		}
+		if cctx.Bool("blockstore-verify") {
+			blockStore = blockstore.NewVerifyBlockStore(blockStore, filepath.Join(lr.Path(), "quarantine"))
+		}
 
 		device := device.NewDevice(
 			deviceID,
@@ -326,12 +400,28 @@ var runCmd = &cli.Command{
 			blockStore)
 
 		params := &helper.NodeParams{
-			DS:              ds,
-			Scheduler:       schedulerAPI,
-			BlockStore:      blockStore,
-			DownloadSrvKey:  cctx.String("download-srv-key"),
-			DownloadSrvAddr: cctx.String("download-srv-addr"),
-			IPFSAPI:         cctx.String("ipfs-api"),
+			DS:                ds,
+			Scheduler:         schedulerAPI,
+			BlockStore:        blockStore,
+			DownloadSrvKey:    cctx.String("download-srv-key"),
+			DownloadSrvAddr:   cctx.String("download-srv-addr"),
+			IPFSAPI:           cctx.String("ipfs-api"),
+			StorageQuota:      cctx.Int64("blockstore-quota"),
+			EvictPolicy:       cctx.String("evict-policy"),
+			HotCacheSize:      cctx.Int64("hot-cache-size"),
+			ReconcileInterval: cctx.Duration("reconcile-interval"),
+			ReconcileRate:     cctx.Int("reconcile-rate"),
+			LoaderWorkers:     cctx.Int("loader-workers"),
+			PartialBlockDir:   filepath.Join(lr.Path(), "partial-blocks"),
+		}
+
+		params.DownloadSrvCertFile = cctx.String("download-srv-cert")
+		params.DownloadSrvKeyFile = cctx.String("download-srv-cert-key")
+		if cctx.Bool("download-srv-tls") && params.DownloadSrvCertFile == "" {
+			params.DownloadSrvCertFile, params.DownloadSrvKeyFile, err = download.SelfSignedCertFiles(lr.Path(), []string{externalIP, internalIP})
+			if err != nil {
+				return xerrors.Errorf("generate self-signed certificate of download server: %w", err)
+			}
 		}
 
 		edgeApi := edge.NewLocalEdgeNode(context.Background(), device, params)
@@ -366,6 +456,7 @@ var runCmd = &cli.Command{
 
 		edge := edgeApi.(*edge.Edge)
 		downloadSrvURL := edge.GetDownloadSrvURL()
+		certFingerprint := edge.GetDownloadSrvCertFingerprint()
 
 		minerSession, err := getSchedulerSession(schedulerAPI, deviceID)
 		if err != nil {
@@ -420,7 +511,14 @@ var runCmd = &cli.Command{
 							return
 						}
 
+						if certFingerprint != "" {
+							err = downloadSrvCertFingerprint(schedulerAPI, certFingerprint)
+							if err != nil {
+								log.Errorf("register certificate fingerprint error:%s", err.Error())
+							}
+						}
 						edge.LoadPublicKey()
+						edge.ReportCacheQueue()
 						log.Info("Edge registered successfully, waiting for tasks")
 						errCount = 0
 						readyCh = nil
@@ -438,6 +536,12 @@ var runCmd = &cli.Command{
 	},
 }
 
+func downloadSrvCertFingerprint(api api.Scheduler, fingerprint string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), helper.SchedulerApiTimeout*time.Second)
+	defer cancel()
+	return api.NodeDownloadSrvCertFingerprint(ctx, fingerprint)
+}
+
 func edgeNodeConnect(api api.Scheduler, rpcURL string, downloadSrvURL string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), helper.SchedulerApiTimeout*time.Second)
 	defer cancel()
@@ -39,3 +39,21 @@ func (r *reader) Read(buf []byte) (int, error) {
 	time.Sleep(delay)
 	return n, err
 }
+
+type readSeeker struct {
+	reader
+	s io.Seeker
+}
+
+// NewReadSeeker returns a rate limited reader which can seek,
+// so it can be served with http.ServeContent
+func NewReadSeeker(rs io.ReadSeeker, l *rate.Limiter) io.ReadSeeker {
+	return &readSeeker{
+		reader: reader{r: rs, limiter: l},
+		s:      rs,
+	}
+}
+
+func (r *readSeeker) Seek(offset int64, whence int) (int64, error) {
+	return r.s.Seek(offset, whence)
+}
@@ -1,3 +1,6 @@
+//go:build bitswap
+// +build bitswap
+
 package p2p
 
 import (
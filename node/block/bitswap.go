@@ -0,0 +1,103 @@
+package block
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	"github.com/linguohua/titan/node/helper"
+)
+
+// Bitswap load blocks from peers with bitswap exchange, no ipfs daemon is needed
+type Bitswap struct {
+	exchange exchange.Interface
+}
+
+func NewBitswap(exchange exchange.Interface) *Bitswap {
+	return &Bitswap{exchange: exchange}
+}
+
+func (bs *Bitswap) loadBlocks(ctx context.Context, block *Block, reqs []*delayReq) ([]blocks.Block, error) {
+	cids := make([]string, 0, len(reqs))
+	for _, req := range reqs {
+		cids = append(cids, req.blockInfo.Cid)
+	}
+
+	return bs.getBlocks(ctx, cids)
+}
+
+func (bs *Bitswap) syncData(block *Block, reqs map[int]string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if len(reqs) == 0 {
+		return nil
+	}
+
+	blockFIDMap := make(map[string]int)
+	cids := make([]string, 0, len(reqs))
+	for fid, cid := range reqs {
+		cids = append(cids, cid)
+		blockFIDMap[cid] = fid
+	}
+
+	for _, group := range groupCids(cids) {
+		blks, err := bs.getBlocks(ctx, group)
+		if err != nil {
+			log.Errorf("syncData getBlocks error:%s", err.Error())
+			return err
+		}
+
+		if len(blks) == 0 {
+			return fmt.Errorf("syncData get blocks is empty")
+		}
+
+		for _, b := range blks {
+			cidStr := b.Cid().String()
+			err = block.saveBlock(ctx, b.RawData(), cidStr, fmt.Sprintf("%d", blockFIDMap[cidStr]))
+			if err != nil {
+				log.Errorf("syncData save block error:%s", err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+// getBlocks return the blocks found before timeout, blocks not found are not in result
+func (bs *Bitswap) getBlocks(ctx context.Context, cidStrs []string) ([]blocks.Block, error) {
+	if bs.exchange == nil {
+		return nil, fmt.Errorf("bitswap exchange is not set")
+	}
+
+	cids := make([]cid.Cid, 0, len(cidStrs))
+	for _, cidStr := range cidStrs {
+		c, err := cid.Decode(cidStr)
+		if err != nil {
+			log.Errorf("getBlocks, decode cid %s error:%s", cidStr, err.Error())
+			continue
+		}
+		cids = append(cids, c)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, helper.BlockDownloadTimeout*time.Second)
+	defer cancel()
+
+	startTime := time.Now()
+
+	ch, err := bs.exchange.GetBlocks(ctx, cids)
+	if err != nil {
+		return nil, err
+	}
+
+	blks := make([]blocks.Block, 0, len(cids))
+	for b := range ch {
+		blks = append(blks, b)
+	}
+
+	log.Infof("getBlocks, block len:%d, duration:%dns", len(blks), time.Since(startTime))
+	return blks, nil
+}
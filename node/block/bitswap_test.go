@@ -0,0 +1,74 @@
+package block
+
+import (
+	"context"
+	"testing"
+
+	testinstance "github.com/ipfs/go-bitswap/testinstance"
+	bstestnet "github.com/ipfs/go-bitswap/testnet"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	delay "github.com/ipfs/go-ipfs-delay"
+	mockrouting "github.com/ipfs/go-ipfs-routing/mock"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/blockstore"
+)
+
+func TestBitswapLoader(t *testing.T) {
+	ctx := context.Background()
+
+	net := bstestnet.VirtualNetwork(mockrouting.NewServer(), delay.Fixed(0))
+	ig := testinstance.NewTestInstanceGenerator(net, nil, nil)
+	defer ig.Close()
+
+	peers := ig.Instances(2)
+	provider, fetcher := peers[0], peers[1]
+
+	blks := make([]blocks.Block, 0, 3)
+	for _, data := range []string{"titan", "bitswap", "loader"} {
+		b := blocks.NewBlock([]byte(data))
+		if err := provider.Blockstore().Put(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+		if err := provider.Exchange.NotifyNewBlocks(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+		blks = append(blks, b)
+	}
+
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	bs := blockstore.NewBlockStore(t.TempDir(), "FileStore")
+	loader := NewBitswap(fetcher.Exchange)
+	block := NewBlock(ds, bs, nil, loader, nil, "http://127.0.0.1:5001", 0)
+
+	reqs := []*delayReq{{blockInfo: api.BlockCacheInfo{Cid: blks[0].Cid().String(), Fid: 1}}}
+	if _, err := NewBitswap(nil).loadBlocks(ctx, block, reqs); err == nil {
+		t.Fatal("load blocks without exchange should fail")
+	}
+
+	loaded, err := loader.loadBlocks(ctx, block, reqs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded) != 1 || !loaded[0].Cid().Equals(blks[0].Cid()) {
+		t.Fatalf("load %d blocks, expect block %s", len(loaded), blks[0].Cid().String())
+	}
+
+	syncReqs := map[int]string{2: blks[1].Cid().String(), 3: blks[2].Cid().String()}
+	if err := loader.syncData(block, syncReqs); err != nil {
+		t.Fatal(err)
+	}
+
+	for fid, cidStr := range syncReqs {
+		data, err := block.getBlockWithCID(cidStr)
+		if err != nil {
+			t.Fatalf("block %s of fid %d not saved: %s", cidStr, fid, err.Error())
+		}
+
+		if string(data) != string(blks[fid-1].RawData()) {
+			t.Fatalf("block %s data mismatch", cidStr)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package block
 import (
 	"container/list"
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"sync"
@@ -11,10 +12,12 @@ import (
 	blocks "github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
-	exchange "github.com/ipfs/go-ipfs-exchange-interface"
 	ipfsApi "github.com/ipfs/go-ipfs-http-client"
 	"github.com/ipfs/go-merkledag"
 	dagpb "github.com/ipld/go-codec-dagpb"
+	// register decoder of dag-cbor and dag-json, links of them are resolved by legacy.DecodeNode with go-ipld-prime
+	_ "github.com/ipld/go-ipld-prime/codec/dagcbor"
+	_ "github.com/ipld/go-ipld-prime/codec/dagjson"
 	"github.com/ipld/go-ipld-prime/node/basicnode"
 	"github.com/linguohua/titan/api"
 	"github.com/linguohua/titan/blockstore"
@@ -36,6 +39,13 @@ type delayReq struct {
 	downloadToken string
 	carFileHash   string
 	CacheID       string
+	reliability   int
+	priority      int
+	// load from the download server of a peer edge with the sign of block, instead of candidate api,
+	// it is false after switch to candidate source
+	fromEdge bool
+	// fingerprint of self-signed certificate of peer edge, empty if not self-signed
+	certFingerprint string
 }
 
 type blockStat struct {
@@ -55,24 +65,45 @@ type Block struct {
 	carfileList *list.List
 	// key is carfile hash
 	// carfileMap    map[string]*list.Element
-	cachingList   []*delayReq
-	saveBlockLock *sync.Mutex
-	blockLoader   BlockLoader
-	device        *device.Device
-	exchange      exchange.Interface
-	blockLoaderCh chan bool
-	ipfsApi       *ipfsApi.HttpApi
-	ipfsGateway   string
+	// protect carfileList and loaderWorkers
+	queueLock     *sync.Mutex
+	queueCond     *sync.Cond
+	loaderWorkers []*loaderWorker
+	// resumed carfiles are not loaded until the queue was reported to scheduler,
+	// new cache requests are loaded as usual
+	waitQueueReport bool
+	saveBlockLock   *sync.Mutex
+	// hash of blocks which are writing to block store, but fid not saved yet
+	savingBlocks sync.Map
+	blockLoader  BlockLoader
+	device       *device.Device
+	ipfsApi      *ipfsApi.HttpApi
+	ipfsGateway  string
+	quota        *storageQuota
+	// cache of blocks for download server, nil if disable
+	hotCache *blockstore.HotCache
+	// directory of partially downloaded blocks under node repo
+	partialBlockDir string
+	// roots of UnixFS files which DAG is complete, value is deleteGeneration when checked
+	availableFiles sync.Map
+	// increased after block was deleted
+	deleteGeneration uint64
 }
 
 type BlockLoader interface {
-	// scheduler request cache carfile
-	loadBlocks(block *Block, reqs []*delayReq) ([]blocks.Block, error)
+	// scheduler request cache carfile, loading is aborted if ctx is cancelled
+	loadBlocks(ctx context.Context, block *Block, reqs []*delayReq) ([]blocks.Block, error)
 	// local sync miss data
 	syncData(block *Block, reqs map[int]string) error
 }
 
-func NewBlock(ds datastore.Batching, blockStore blockstore.BlockStore, scheduler api.Scheduler, blockLoader BlockLoader, device *device.Device, ipfsApiURL string) *Block {
+// rawBlockLoader stream raw block to block store, the whole block will not be buffered in memory
+type rawBlockLoader interface {
+	// return size of the block
+	loadRawBlock(ctx context.Context, block *Block, req *delayReq) (int, error)
+}
+
+func NewBlock(ds datastore.Batching, blockStore blockstore.BlockStore, scheduler api.Scheduler, blockLoader BlockLoader, device *device.Device, ipfsApiURL string, loaderWorkers int) *Block {
 	httpClient := &http.Client{}
 	httpApi, err := ipfsApi.NewURLApiWithClient(ipfsApiURL, httpClient)
 	if err != nil {
@@ -84,17 +115,23 @@ func NewBlock(ds datastore.Batching, blockStore blockstore.BlockStore, scheduler
 		blockStore:  blockStore,
 		scheduler:   scheduler,
 		blockLoader: blockLoader,
-		exchange:    nil,
 		device:      device,
 
 		saveBlockLock: &sync.Mutex{},
 
-		blockLoaderCh: make(chan bool),
-		ipfsApi:       httpApi,
-		carfileList:   list.New(),
+		queueLock:   &sync.Mutex{},
+		ipfsApi:     httpApi,
+		carfileList: list.New(),
 	}
+	block.queueCond = sync.NewCond(block.queueLock)
+
+	if notifier, ok := blockStore.(blockstore.CorruptNotifier); ok {
+		notifier.SetCorruptHandler(block.onBlockCorrupted)
+	}
+
+	block.loadCacheReqs()
 
-	go block.startBlockLoader()
+	block.startBlockLoaders(loaderWorkers)
 
 	legacy.RegisterCodec(cid.DagProtobuf, dagpb.Type.PBNode, merkledag.ProtoNodeConverter)
 	legacy.RegisterCodec(cid.Raw, basicnode.Prototype.Bytes, merkledag.RawNodeConverter)
@@ -109,81 +146,46 @@ func apiReq2DelayReq(req *api.ReqCacheData) []*delayReq {
 			continue
 		}
 
-		req := &delayReq{blockInfo: blockInfo, count: 0, downloadURL: req.DownloadURL, downloadToken: req.DownloadToken, carFileHash: req.CardFileHash, CacheID: req.CacheID}
+		req := &delayReq{blockInfo: blockInfo, count: 0, downloadURL: req.DownloadURL, downloadToken: req.DownloadToken, carFileHash: req.CardFileHash, CacheID: req.CacheID, reliability: req.Reliability, priority: req.Priority, fromEdge: req.FromEdge, certFingerprint: req.DownloadCertFingerprint}
 		results = append(results, req)
 	}
 
 	return results
 }
 
-func (block *Block) startBlockLoader() {
-	if block.blockLoader == nil {
-		log.Panic("block.block == nil")
-	}
-
-	for {
-		<-block.blockLoaderCh
-		block.doLoadBlock()
-	}
-}
-
-func (block *Block) notifyBlockLoader() {
-	select {
-	case block.blockLoaderCh <- true:
-	default:
-	}
-}
-
-func (block *Block) doLoadBlock() {
-	for element := block.carfileList.Front(); element != nil; {
-		carfile, ok := element.Value.(*carfile)
-		if !ok {
-			log.Panicf("doLoadBlock error, can convert elemnet to carfile")
-		}
-
-		log.Infof("doLoadBlock, carfile hash:%s, delay reqs len:%d", carfile.carfileHash, len(carfile.delayReqs))
-		for len(carfile.delayReqs) > 0 {
-			doLen := len(carfile.delayReqs)
-			if doLen > helper.Batch {
-				doLen = helper.Batch
-			}
-
-			doReqs := carfile.removeReq(doLen)
-			block.cachingList = doReqs
-
-			block.loadBlocks(doReqs)
-			block.cachingList = nil
-		}
-
-		preElement := element
-		element = preElement.Next()
-		block.carfileList.Remove(preElement)
-	}
-}
-
-func (block *Block) loadBlocks(reqs []*delayReq) {
+// loadBlocks load the blocks and report the result to scheduler,
+// if ctx is cancelled, the blocks not loaded yet are reported as cancelled
+func (block *Block) loadBlocks(ctx context.Context, reqs []*delayReq) {
 	reqs = block.filterAvailableReq(reqs)
 	if len(reqs) == 0 {
 		log.Debug("loadBlocks, len(reqs) == 0")
 		return
 	}
 
-	ctx := context.Background()
+	if loader, ok := block.blockLoader.(rawBlockLoader); ok {
+		reqs = block.loadRawBlocks(ctx, loader, reqs)
+		if len(reqs) == 0 {
+			return
+		}
+	}
 
-	cids := make([]string, 0, len(reqs))
+	// blocks loaded as raw block are done, only the remain reqs need to retry
 	reqMap := make(map[string]*delayReq)
 	for _, req := range reqs {
-		cids = append(cids, req.blockInfo.Cid)
 		reqMap[req.blockInfo.Cid] = req
 	}
 
-	blocks, err := block.blockLoader.loadBlocks(block, reqs)
+	blocks, err := block.blockLoader.loadBlocks(ctx, block, reqs)
 	if err != nil {
+		// all blocks failed, retry them below
 		log.Errorf("loadBlocksAsync loadBlocks err %v", err)
-		return
 	}
 
 	for _, b := range blocks {
+		if ctx.Err() != nil {
+			break
+		}
+
 		cidStr := b.Cid().String()
 		req, exist := reqMap[cidStr]
 		if !exist {
@@ -197,6 +199,8 @@ func (block *Block) loadBlocks(reqs []*delayReq) {
 			continue
 		}
 
+		block.setBlockMetaCarfile(b.Cid().Hash().String(), req.carFileHash, req.reliability)
+
 		// get block links
 		links, err := block.resolveLinks(b)
 		if err != nil {
@@ -219,25 +223,167 @@ func (block *Block) loadBlocks(reqs []*delayReq) {
 		delete(reqMap, cidStr)
 	}
 
-	err = fmt.Errorf("Request timeout")
+	if ctx.Err() != nil {
+		block.cacheCancelled(reqMapToList(reqMap))
+		return
+	}
+
+	if err == nil {
+		err = fmt.Errorf("Request timeout")
+	}
 	tryDelayReqs := make([]*delayReq, 0)
+	failedReqs := make([]*delayReq, 0)
+	// count is read by QueryCacheStat with queueLock
+	block.queueLock.Lock()
 	for _, v := range reqMap {
 		if v.count >= helper.BlockDownloadRetryNum {
-			block.cacheResultWithError(blockStat{cid: v.blockInfo.Cid, carFileHash: v.carFileHash, CacheID: v.CacheID}, err)
-			log.Infof("cache data faile, cid:%s, count:%d", v.blockInfo.Cid, v.count)
+			failedReqs = append(failedReqs, v)
 		} else {
 			v.count++
 			delayReq := v
 			tryDelayReqs = append(tryDelayReqs, delayReq)
 		}
 	}
+	block.queueLock.Unlock()
+
+	for _, v := range failedReqs {
+		block.cacheResultWithError(blockStat{cid: v.blockInfo.Cid, carFileHash: v.carFileHash, CacheID: v.CacheID}, err)
+		log.Infof("cache data faile, cid:%s, count:%d", v.blockInfo.Cid, v.count)
+	}
+
+	if len(tryDelayReqs) == 0 {
+		return
+	}
+
+	block.switchDownloadSource(tryDelayReqs)
+
+	backoff := retryBackoff(tryDelayReqs[0].count)
+	log.Infof("loadBlocks, retry %d blocks after %s", len(tryDelayReqs), backoff)
+
+	select {
+	case <-time.After(backoff):
+	case <-ctx.Done():
+		block.cacheCancelled(tryDelayReqs)
+		return
+	}
+
+	block.loadBlocks(ctx, tryDelayReqs)
+}
+
+func reqMapToList(reqMap map[string]*delayReq) []*delayReq {
+	reqs := make([]*delayReq, 0, len(reqMap))
+	for _, req := range reqMap {
+		reqs = append(reqs, req)
+	}
+
+	return reqs
+}
+
+// cacheCancelled report the blocks which were not cached because the caching of carfile was cancelled
+func (block *Block) cacheCancelled(reqs []*delayReq) {
+	for _, req := range reqs {
+		block.cacheResultWithError(blockStat{cid: req.blockInfo.Cid, carFileHash: req.carFileHash, CacheID: req.CacheID}, context.Canceled)
+	}
+}
+
+// retryBackoff return the wait time before the count-th retry, doubled every retry
+func retryBackoff(count int) time.Duration {
+	backoff := time.Duration(helper.BlockDownloadRetryBackoff) * time.Second
+	for i := 1; i < count; i++ {
+		backoff *= 2
+		if backoff >= helper.BlockDownloadRetryBackoffMax*time.Second {
+			return helper.BlockDownloadRetryBackoffMax * time.Second
+		}
+	}
+
+	return backoff
+}
+
+// switchDownloadSource ask scheduler for another candidate to download the blocks,
+// if they were failed to download from the assigned source for several times
+func (block *Block) switchDownloadSource(reqs []*delayReq) {
+	reqMap := make(map[string]*delayReq)
+	cids := make([]string, 0)
+	for _, req := range reqs {
+		if req.downloadURL == "" || req.count < helper.BlockDownloadSwitchSourceNum {
+			continue
+		}
+
+		reqMap[req.blockInfo.Cid] = req
+		cids = append(cids, req.blockInfo.Cid)
+	}
+
+	if len(cids) == 0 {
+		return
+	}
+
+	infos, err := getCandidateDownloadInfoWithBlocks(block.scheduler, cids)
+	if err != nil {
+		log.Errorf("switchDownloadSource, GetCandidateDownloadInfoWithBlocks error:%s", err.Error())
+		return
+	}
+
+	for cid, info := range infos {
+		req, exist := reqMap[cid]
+		if !exist || info.URL == "" {
+			continue
+		}
+
+		if info.URL != req.downloadURL {
+			log.Infof("switchDownloadSource, cid:%s, from %s to %s", cid, req.downloadURL, info.URL)
+		}
+
+		req.downloadURL = info.URL
+		req.downloadToken = info.Token
+		req.fromEdge = false
+	}
+}
+
+// load raw blocks with loader, return the reqs which are not raw block or load failed
+func (block *Block) loadRawBlocks(ctx context.Context, loader rawBlockLoader, reqs []*delayReq) []*delayReq {
+	remainReqs := make([]*delayReq, 0, len(reqs))
+	lock := &sync.Mutex{}
+
+	var wg sync.WaitGroup
+	for _, req := range reqs {
+		target, err := cid.Decode(req.blockInfo.Cid)
+		if err != nil || target.Prefix().Codec != cid.Raw {
+			lock.Lock()
+			remainReqs = append(remainReqs, req)
+			lock.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func(req *delayReq) {
+			defer wg.Done()
+
+			size, err := loader.loadRawBlock(ctx, block, req)
+			if err != nil {
+				log.Errorf("loadRawBlocks, cid:%s, error:%s", req.blockInfo.Cid, err.Error())
+				lock.Lock()
+				remainReqs = append(remainReqs, req)
+				lock.Unlock()
+				return
+			}
+
+			block.setBlockMetaCarfile(target.Hash().String(), req.carFileHash, req.reliability)
 
-	if len(tryDelayReqs) > 0 {
-		block.loadBlocks(tryDelayReqs)
+			bStat := blockStat{cid: req.blockInfo.Cid, links: []string{}, blockSize: size, carFileHash: req.carFileHash, CacheID: req.CacheID}
+			block.cacheResult(bStat, nil)
+
+			log.Infof("cache raw data,cid:%s", req.blockInfo.Cid)
+		}(req)
 	}
+	wg.Wait()
+
+	return remainReqs
 }
 
 func (block *Block) getWaitCacheBlockNum() int {
+	block.queueLock.Lock()
+	defer block.queueLock.Unlock()
+
 	count := 0
 	for e := block.carfileList.Front(); e != nil; e = e.Next() {
 		carfile := e.Value.(*carfile)
@@ -246,6 +392,7 @@ func (block *Block) getWaitCacheBlockNum() int {
 	return count
 }
 
+// must hold queueLock
 func (block *Block) getElementFromList(carfileHash string) *list.Element {
 	for e := block.carfileList.Front(); e != nil; e = e.Next() {
 		carfile := e.Value.(*carfile)
@@ -257,40 +404,65 @@ func (block *Block) getElementFromList(carfileHash string) *list.Element {
 }
 
 func (block *Block) addReq2WaitList(req *api.ReqCacheData) {
-	e := block.getElementFromList(req.CardFileHash)
+	delayReqs := apiReq2DelayReq(req)
+	block.saveCacheReqs(delayReqs)
+
+	block.queueLock.Lock()
+	defer block.queueLock.Unlock()
+
+	block.addReqsToCarfile(req.CardFileHash, req.Priority, delayReqs)
+	block.queueCond.Broadcast()
+}
+
+// add reqs to the carfile in queue, priority of carfile is the highest of its reqs, must hold queueLock
+func (block *Block) addReqsToCarfile(carfileHash string, priority int, delayReqs []*delayReq) {
+	e := block.getElementFromList(carfileHash)
 	if e == nil {
-		cf := &carfile{carfileHash: req.CardFileHash, lock: &sync.Mutex{}, delayReqs: make([]*delayReq, 0)}
+		cf := &carfile{carfileHash: carfileHash, lock: &sync.Mutex{}, delayReqs: make([]*delayReq, 0), priority: priority}
 		e = block.carfileList.PushBack(cf)
 	}
 
 	carfile, ok := e.Value.(*carfile)
 	if !ok {
-		log.Panicf("addReq2WaitList, can not convert elemnet to carfile")
+		log.Panicf("addReqsToCarfile, can not convert elemnet to carfile")
 	}
 
-	carfile.addReq(apiReq2DelayReq(req))
+	if priority > carfile.priority {
+		carfile.priority = priority
+	}
 
-	block.notifyBlockLoader()
+	carfile.addReq(delayReqs)
 }
+
+// RemoveWaitCacheBlockWith cancel caching of carfile, blocks waiting in queue are removed and loading blocks are aborted,
+// all of them are reported to scheduler as cancelled
 func (block *Block) RemoveWaitCacheBlockWith(ctx context.Context, carfileCID string) error {
 	carfileHash, err := helper.CIDString2HashString(carfileCID)
 	if err != nil {
 		return err
 	}
 
+	var reqs []*delayReq
+
+	block.queueLock.Lock()
+	block.cancelLoading(carfileHash)
+
 	e := block.getElementFromList(carfileHash)
-	if e == nil {
-		return nil
-	}
+	if e != nil {
+		carfile, ok := e.Value.(*carfile)
+		if !ok {
+			log.Panicf("RemoveCarfileFromList error, can not convert elemnet to carfile")
+		}
 
-	carfile, ok := e.Value.(*carfile)
-	if !ok {
-		log.Panicf("RemoveCarfileFromList error, can not convert elemnet to carfile")
-	}
+		reqs = carfile.delayReqs
+		carfile.delayReqs = nil
 
-	carfile.delayReqs = nil
+		block.carfileList.Remove(e)
+	}
+	block.queueLock.Unlock()
 
-	block.carfileList.Remove(e)
+	block.removeCarfileCacheReqs(carfileHash)
+	block.cacheCancelled(reqs)
 
 	return nil
 }
@@ -311,6 +483,7 @@ func (block *Block) cacheResult(bStat blockStat, err error) {
 	result := api.CacheResultInfo{
 		Cid:         bStat.cid,
 		IsOK:        success,
+		Cancelled:   errors.Is(err, context.Canceled),
 		Msg:         errMsg,
 		From:        "",
 		Links:       bStat.links,
@@ -434,6 +607,41 @@ func (block *Block) AnnounceBlocksWasDelete(ctx context.Context, cids []string)
 	return failedResults, nil
 }
 
+// block was corrupted and quarantined by block store,
+// remove the fid of it and told scheduler to cache it again
+func (block *Block) onBlockCorrupted(hash string) {
+	cidStr, err := helper.HashString2CidString(hash)
+	if err != nil {
+		log.Errorf("onBlockCorrupted, HashString2CidString error:%s, hash:%s", err.Error(), hash)
+		return
+	}
+
+	target, err := cid.Decode(cidStr)
+	if err != nil {
+		log.Errorf("onBlockCorrupted, decode cid %s error:%s", cidStr, err.Error())
+		return
+	}
+
+	_, err = block.deleteFIDAndHash(target)
+	if err != nil && err != datastore.ErrNotFound {
+		log.Errorf("onBlockCorrupted, deleteFIDAndHash error:%s, cid:%s", err.Error(), cidStr)
+	}
+	block.deleteBlockMeta(hash)
+	block.invalidateHotCache(hash)
+	block.invalidateAvailableFiles()
+
+	ctx, cancel := context.WithTimeout(context.Background(), helper.SchedulerApiTimeout*time.Second)
+	defer cancel()
+
+	err = block.scheduler.NodeReportCorruptedBlocks(ctx, []string{cidStr})
+	if err != nil {
+		log.Errorf("onBlockCorrupted, NodeReportCorruptedBlocks error:%s, cid:%s", err.Error(), cidStr)
+		return
+	}
+
+	log.Warnf("block %s was corrupted, report to scheduler", cidStr)
+}
+
 func (block *Block) QueryCacheStat(ctx context.Context) (api.CacheStat, error) {
 	result := api.CacheStat{}
 
@@ -444,9 +652,14 @@ func (block *Block) QueryCacheStat(ctx context.Context) (api.CacheStat, error) {
 
 	result.CacheBlockCount = keyCount
 	result.WaitCacheBlockNum = block.getWaitCacheBlockNum()
-	result.DoingCacheBlockNum = len(block.cachingList)
-	result.RetryNum = helper.BlockDownloadRetryNum
-	result.DownloadTimeout = helper.BlockDownloadTimeout
+	result.DoingCacheBlockNum = block.getLoadingBlockNum()
+	result.RetryNum = block.getLoadingRetryNum()
+	// every try of download cost DownloadTimeout at most with the backoff
+	result.DownloadTimeout = helper.BlockDownloadTimeout + helper.BlockDownloadRetryBackoffMax
+
+	if block.hotCache != nil {
+		result.HotCacheHits, result.HotCacheMisses = block.hotCache.CacheStat()
+	}
 
 	deviceInfo, err := block.device.DeviceInfo(context.Background())
 	if err == nil {
@@ -463,9 +676,9 @@ func (block *Block) BlockStoreStat(ctx context.Context) error {
 	return nil
 }
 
+// QueryCachingBlocks return the blocks are loading by every worker and waiting in queue
 func (block *Block) QueryCachingBlocks(ctx context.Context) (api.CachingBlockList, error) {
-	result := api.CachingBlockList{}
-	return result, nil
+	return api.CachingBlockList{List: block.getCachingBlockStats()}, nil
 }
 
 func (block *Block) LoadBlock(ctx context.Context, cid string) ([]byte, error) {
@@ -530,3 +743,32 @@ func getLinks(block *Block, data []byte, cidStr string) ([]*format.Link, error)
 
 	return block.resolveLinks(blk)
 }
+
+// SetHotCache cache the blocks read by download server in memory, size <= 0 means disable
+func (block *Block) SetHotCache(size int64) {
+	if size <= 0 {
+		return
+	}
+
+	block.hotCache = blockstore.NewHotCache(block.blockStore, size)
+	log.Infof("hot cache size %d", size)
+}
+
+// SetPartialBlockDir set the directory of partially downloaded blocks, it should be under node repo,
+// so the download can be resumed after restart
+func (block *Block) SetPartialBlockDir(dir string) {
+	block.partialBlockDir = dir
+}
+
+// HotCache return nil if hot cache disable
+func (block *Block) HotCache() *blockstore.HotCache {
+	return block.hotCache
+}
+
+func (block *Block) invalidateHotCache(hash string) {
+	if block.hotCache == nil {
+		return
+	}
+
+	block.hotCache.Invalidate(hash)
+}
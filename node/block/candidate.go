@@ -20,8 +20,23 @@ type Candidate struct {
 	token      string
 }
 
-func (candidate *Candidate) loadBlocks(block *Block, reqs []*delayReq) ([]blocks.Block, error) {
-	return getBlocksFromCandidate(reqs)
+func (candidate *Candidate) loadBlocks(ctx context.Context, block *Block, reqs []*delayReq) ([]blocks.Block, error) {
+	edgeReqs := make([]*delayReq, 0)
+	candidateReqs := make([]*delayReq, 0, len(reqs))
+	for _, req := range reqs {
+		if req.fromEdge {
+			edgeReqs = append(edgeReqs, req)
+		} else {
+			candidateReqs = append(candidateReqs, req)
+		}
+	}
+
+	blks, err := getBlocksFromCandidate(ctx, candidateReqs)
+	if len(edgeReqs) > 0 {
+		blks = append(blks, getBlocksFromEdge(ctx, edgeReqs)...)
+	}
+
+	return blks, err
 }
 
 func (candidate *Candidate) syncData(block *Block, reqs map[int]string) error {
@@ -60,7 +75,7 @@ func (candidate *Candidate) syncData(block *Block, reqs map[int]string) error {
 				continue
 			}
 
-			blk, err := getBlockFromCandidateWithApi(candidate, cid)
+			blk, err := getBlockFromCandidateWithApi(ctx, candidate, cid)
 			if err != nil {
 				log.Errorf("syncData LoadBlock error:%s", err.Error())
 				continue
@@ -85,8 +100,8 @@ func getCandidateDownloadInfoWithBlocks(scheduler api.Scheduler, cids []string)
 	return scheduler.GetCandidateDownloadInfoWithBlocks(ctx, cids)
 }
 
-func getBlockFromCandidateWithApi(candidate api.Candidate, cidStr string) (blocks.Block, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), helper.BlockDownloadTimeout*time.Second)
+func getBlockFromCandidateWithApi(ctx context.Context, candidate api.Candidate, cidStr string) (blocks.Block, error) {
+	ctx, cancel := context.WithTimeout(ctx, helper.BlockDownloadTimeout*time.Second)
 	defer cancel()
 
 	data, err := candidate.LoadBlock(ctx, cidStr)
@@ -107,10 +122,11 @@ func getBlockFromCandidateWithApi(candidate api.Candidate, cidStr string) (block
 	return basicBlock, nil
 }
 
-func getBlocksFromCandidate(reqs []*delayReq) ([]blocks.Block, error) {
+func getBlocksFromCandidate(ctx context.Context, reqs []*delayReq) ([]blocks.Block, error) {
 	startTime := time.Now()
 	blks := make([]blocks.Block, 0, len(reqs))
 	candidates := make(map[string]api.Candidate)
+	lock := &sync.Mutex{}
 
 	var wg sync.WaitGroup
 
@@ -128,12 +144,15 @@ func getBlocksFromCandidate(reqs []*delayReq) ([]blocks.Block, error) {
 		go func() {
 			defer wg.Done()
 
-			b, err := getBlockFromCandidateWithApi(candidate, delayReq.blockInfo.Cid)
+			b, err := getBlockFromCandidateWithApi(ctx, candidate, delayReq.blockInfo.Cid)
 			if err != nil {
 				log.Errorf("getBlocksFromCandidateWithApi error:%s", err.Error())
 				return
 			}
+
+			lock.Lock()
 			blks = append(blks, b)
+			lock.Unlock()
 		}()
 	}
 	wg.Wait()
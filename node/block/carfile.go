@@ -6,6 +6,10 @@ type carfile struct {
 	carfileHash string
 	delayReqs   []*delayReq
 	lock        *sync.Mutex
+	// carfile with higher priority is loaded first
+	priority int
+	// carfile resumed from saved queue is not loaded until the queue was reported to scheduler
+	resumed bool
 }
 
 func (carfile *carfile) removeReq(len int) []*delayReq {
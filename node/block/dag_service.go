@@ -0,0 +1,69 @@
+package block
+
+import (
+	"context"
+	"fmt"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	legacy "github.com/ipfs/go-ipld-legacy"
+)
+
+// storeDAGService read nodes from block store, it is read only
+type storeDAGService struct {
+	block *Block
+	// return the block which is not saved to block store yet, nil if all blocks are read from block store
+	unsaved func(c cid.Cid) (blocks.Block, bool)
+}
+
+func newStoreDAGService(block *Block) *storeDAGService {
+	return &storeDAGService{block: block}
+}
+
+func (dagService *storeDAGService) Get(ctx context.Context, c cid.Cid) (format.Node, error) {
+	if dagService.unsaved != nil {
+		if b, ok := dagService.unsaved(c); ok {
+			return legacy.DecodeNode(ctx, b)
+		}
+	}
+
+	data, err := dagService.block.getBlockWithCID(c.String())
+	if err != nil {
+		return nil, format.ErrNotFound{Cid: c}
+	}
+
+	b, err := blocks.NewBlockWithCid(data, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return legacy.DecodeNode(ctx, b)
+}
+
+func (dagService *storeDAGService) GetMany(ctx context.Context, cids []cid.Cid) <-chan *format.NodeOption {
+	out := make(chan *format.NodeOption, len(cids))
+	for _, c := range cids {
+		node, err := dagService.Get(ctx, c)
+		out <- &format.NodeOption{Node: node, Err: err}
+	}
+	close(out)
+
+	return out
+}
+
+func (dagService *storeDAGService) Add(ctx context.Context, node format.Node) error {
+	return fmt.Errorf("add block is not supported in block store dag service")
+}
+
+func (dagService *storeDAGService) AddMany(ctx context.Context, nodes []format.Node) error {
+	return fmt.Errorf("add block is not supported in block store dag service")
+}
+
+func (dagService *storeDAGService) Remove(ctx context.Context, c cid.Cid) error {
+	return fmt.Errorf("remove block is not supported in block store dag service")
+}
+
+func (dagService *storeDAGService) RemoveMany(ctx context.Context, cids []cid.Cid) error {
+	return fmt.Errorf("remove block is not supported in block store dag service")
+}
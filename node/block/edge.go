@@ -0,0 +1,133 @@
+package block
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/linguohua/titan/node/helper"
+)
+
+// edgeBlockURL return the url of block in the download server of a peer edge,
+// with the token of carfile and the sign of block from scheduler
+func edgeBlockURL(req *delayReq) string {
+	return fmt.Sprintf("%s?cid=%s&%s&sign=%s", req.downloadURL, url.QueryEscape(req.blockInfo.Cid), req.downloadToken, url.QueryEscape(req.blockInfo.Sign))
+}
+
+// http clients of peer edges with self-signed certificate, key is fingerprint
+var edgeClients sync.Map
+
+// edgeHTTPClient return the http client for the download server of a peer edge,
+// the self-signed certificate of peer edge is pinned with the fingerprint registered to scheduler
+func edgeHTTPClient(fingerprint string) *http.Client {
+	if fingerprint == "" {
+		return http.DefaultClient
+	}
+
+	if client, ok := edgeClients.Load(fingerprint); ok {
+		return client.(*http.Client)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// self-signed certificate can not be verified by CA, it is verified with fingerprint
+		InsecureSkipVerify: true, //nolint:gosec
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 || helper.CertFingerprint(rawCerts[0]) != fingerprint {
+				return fmt.Errorf("certificate of peer edge does not match fingerprint %s", fingerprint)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	client, _ := edgeClients.LoadOrStore(fingerprint, &http.Client{Transport: transport})
+	return client.(*http.Client)
+}
+
+// getBlocksFromEdge download blocks from the download servers of peer edges concurrently,
+// the blocks failed to download are not returned
+func getBlocksFromEdge(ctx context.Context, reqs []*delayReq) []blocks.Block {
+	startTime := time.Now()
+	blks := make([]blocks.Block, 0, len(reqs))
+	lock := &sync.Mutex{}
+
+	var wg sync.WaitGroup
+	for _, req := range reqs {
+		delayReq := req
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			b, err := getBlockFromEdge(ctx, delayReq)
+			if err != nil {
+				log.Errorf("getBlockFromEdge error:%s", err.Error())
+				return
+			}
+
+			lock.Lock()
+			blks = append(blks, b)
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	log.Infof("getBlocksFromEdge block len:%d, duration:%dns", len(blks), time.Since(startTime))
+	return blks
+}
+
+// getBlockFromEdge download block from the download server of a peer edge,
+// the block is signed by scheduler, data of block is checked with the hash of cid
+func getBlockFromEdge(ctx context.Context, req *delayReq) (blocks.Block, error) {
+	cidStr := req.blockInfo.Cid
+	target, err := cid.Decode(cidStr)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, helper.BlockDownloadTimeout*time.Second)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, edgeBlockURL(req), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := edgeHTTPClient(req.certFingerprint).Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("download block %s from %s, status code %d, %s", cidStr, req.downloadURL, resp.StatusCode, string(msg))
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	sum, err := target.Prefix().Sum(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if !sum.Equals(target) {
+		return nil, fmt.Errorf("block %s from %s does not match hash", cidStr, req.downloadURL)
+	}
+
+	return blocks.NewBlockWithCid(data, target)
+}
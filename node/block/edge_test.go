@@ -0,0 +1,107 @@
+package block
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ipfs/go-merkledag"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/helper"
+)
+
+func TestGetBlocksFromEdge(t *testing.T) {
+	good := merkledag.NewRawNode([]byte("titan edge block"))
+	tampered := merkledag.NewRawNode([]byte("titan edge tampered block"))
+	unsigned := merkledag.NewRawNode([]byte("titan edge unsigned block"))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("carfile") != "carfile" || query.Get("sign") != "sign of "+query.Get("cid") {
+			http.Error(w, "verify sign failed", http.StatusForbidden)
+			return
+		}
+
+		switch query.Get("cid") {
+		case good.Cid().String():
+			w.Write(good.RawData()) //nolint:errcheck
+		case tampered.Cid().String():
+			w.Write([]byte("tampered data")) //nolint:errcheck
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	newReq := func(cidStr, sign string) *delayReq {
+		return &delayReq{
+			blockInfo:     api.BlockCacheInfo{Cid: cidStr, Sign: sign},
+			downloadURL:   srv.URL,
+			downloadToken: "carfile=carfile&signTime=0&timeout=0",
+			fromEdge:      true,
+		}
+	}
+
+	goodReq := newReq(good.Cid().String(), "sign of "+good.Cid().String())
+	b, err := getBlockFromEdge(context.Background(), goodReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.Cid().Equals(good.Cid()) {
+		t.Fatalf("get block %s, expect %s", b.Cid().String(), good.Cid().String())
+	}
+
+	if _, err := getBlockFromEdge(context.Background(), newReq(tampered.Cid().String(), "sign of "+tampered.Cid().String())); err == nil {
+		t.Fatal("block does not match hash should fail")
+	}
+
+	if _, err := getBlockFromEdge(context.Background(), newReq(unsigned.Cid().String(), "sign of "+good.Cid().String())); err == nil {
+		t.Fatal("block with sign of other block should fail")
+	}
+
+	// only the good block is loaded, edge reqs are not loaded from candidate api
+	blks, err := (&Candidate{}).loadBlocks(context.Background(), nil, []*delayReq{
+		goodReq,
+		newReq(tampered.Cid().String(), "sign of "+tampered.Cid().String()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blks) != 1 || !blks[0].Cid().Equals(good.Cid()) {
+		t.Fatalf("load %d blocks, expect only %s", len(blks), good.Cid().String())
+	}
+}
+
+func TestGetBlockFromEdgeWithPinnedCert(t *testing.T) {
+	b := merkledag.NewRawNode([]byte("titan edge tls block"))
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(b.RawData()) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	newReq := func(fingerprint string) *delayReq {
+		return &delayReq{
+			blockInfo:       api.BlockCacheInfo{Cid: b.Cid().String(), Sign: "sign"},
+			downloadURL:     srv.URL,
+			downloadToken:   "carfile=carfile&signTime=0&timeout=0",
+			fromEdge:        true,
+			certFingerprint: fingerprint,
+		}
+	}
+
+	// self-signed certificate of peer edge is verified with fingerprint
+	if _, err := getBlockFromEdge(context.Background(), newReq(helper.CertFingerprint(srv.Certificate().Raw))); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := getBlockFromEdge(context.Background(), newReq(helper.CertFingerprint([]byte("other certificate")))); err == nil {
+		t.Fatal("certificate does not match fingerprint should fail")
+	}
+
+	if _, err := getBlockFromEdge(context.Background(), newReq("")); err == nil {
+		t.Fatal("self-signed certificate without fingerprint should fail")
+	}
+}
@@ -0,0 +1,159 @@
+package block
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	carv1 "github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	"github.com/linguohua/titan/api"
+)
+
+// max number of missing cids in error message
+const missingCidsInErrorMax = 100
+
+// MissingBlocksError the DAG of carfile is not complete in block store
+type MissingBlocksError struct {
+	CarfileCid string
+	Cids       []string
+}
+
+func (e *MissingBlocksError) Error() string {
+	cids := e.Cids
+	if len(cids) > missingCidsInErrorMax {
+		cids = cids[:missingCidsInErrorMax]
+	}
+
+	msg := fmt.Sprintf("carfile %s missing %d blocks: %s", e.CarfileCid, len(e.Cids), strings.Join(cids, ","))
+	if len(e.Cids) > len(cids) {
+		msg += ",..."
+	}
+
+	return msg
+}
+
+// ExportCarfile write the DAG of carfile in block store to a CARv1 file in local path,
+// the file must not exist
+func (block *Block) ExportCarfile(ctx context.Context, carfileCid, path string) (api.ExportCarfileResult, error) {
+	root, err := cid.Decode(carfileCid)
+	if err != nil {
+		return api.ExportCarfileResult{}, err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return api.ExportCarfileResult{}, err
+	}
+
+	result, err := block.WriteCarfile(ctx, root, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		log.Errorf("ExportCarfile, export %s error:%s", carfileCid, err.Error())
+		os.Remove(path) //nolint:errcheck
+		return api.ExportCarfileResult{}, err
+	}
+
+	log.Infof("ExportCarfile, export %s to %s, blocks %d, size %d", carfileCid, path, result.Blocks, result.TotalSize)
+	return result, nil
+}
+
+// WriteCarfile walk the DAG from root in block store and write it as CARv1,
+// DAG is checked before writing, nothing is written and return MissingBlocksError if any block is missing
+func (block *Block) WriteCarfile(ctx context.Context, root cid.Cid, w io.Writer) (api.ExportCarfileResult, error) {
+	return block.WritePathCarfile(ctx, []cid.Cid{root}, w)
+}
+
+// WritePathCarfile write the blocks on path and the DAG of target as CARv1 with the root of path,
+// so the client can verify the path from root to target.
+// Only the nodes on path are written for HAMT directory, the shards between them are not included
+func (block *Block) WritePathCarfile(ctx context.Context, pathCids []cid.Cid, w io.Writer) (api.ExportCarfileResult, error) {
+	target := pathCids[len(pathCids)-1]
+	cids, err := block.walkCarfile(ctx, target)
+	if err != nil {
+		return api.ExportCarfileResult{}, err
+	}
+
+	root := pathCids[0]
+	err = carv1.WriteHeader(&carv1.CarHeader{Roots: []cid.Cid{root}, Version: 1}, w)
+	if err != nil {
+		return api.ExportCarfileResult{}, err
+	}
+
+	result := api.ExportCarfileResult{CarfileCid: root.String()}
+	// blocks on path before target, then DAG of target
+	cids = append(pathCids[:len(pathCids)-1:len(pathCids)-1], cids...)
+	for _, c := range cids {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+
+		data, err := block.blockStore.Get(c.Hash().String())
+		if err != nil {
+			return result, fmt.Errorf("get block %s error:%s", c.String(), err.Error())
+		}
+
+		err = carutil.LdWrite(w, c.Bytes(), data)
+		if err != nil {
+			return result, err
+		}
+
+		result.Blocks++
+		result.TotalSize += int64(len(data))
+	}
+
+	return result, nil
+}
+
+// walkCarfile return the cids of DAG in depth first order, every block only once
+func (block *Block) walkCarfile(ctx context.Context, root cid.Cid) ([]cid.Cid, error) {
+	cids := make([]cid.Cid, 0)
+	missing := make([]string, 0)
+	visited := make(map[string]struct{})
+
+	stack := []cid.Cid{root}
+	for len(stack) > 0 {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		hash := c.Hash().String()
+		if _, exist := visited[hash]; exist {
+			continue
+		}
+		visited[hash] = struct{}{}
+
+		data, err := block.blockStore.Get(hash)
+		if err != nil {
+			missing = append(missing, c.String())
+			continue
+		}
+
+		links, err := getLinks(block, data, c.String())
+		if err != nil {
+			return nil, fmt.Errorf("resolve links of %s error:%s", c.String(), err.Error())
+		}
+
+		cids = append(cids, c)
+
+		// push in reverse order, so the first link is visited first
+		for i := len(links) - 1; i >= 0; i-- {
+			stack = append(stack, links[i].Cid)
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, &MissingBlocksError{CarfileCid: root.String(), Cids: missing}
+	}
+
+	return cids, nil
+}
@@ -0,0 +1,63 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExportImportCarfile(t *testing.T) {
+	ctx := context.Background()
+	path, cids := writeCarFile(t)
+
+	src := newImportBlock(t, &importScheduler{})
+	if _, err := src.ImportCarfile(ctx, path, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	exportPath := filepath.Join(t.TempDir(), "export.car")
+	exported, err := src.ExportCarfile(ctx, cids[0].String(), exportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exported.CarfileCid != cids[0].String() || exported.Blocks != len(cids) {
+		t.Fatalf("export result %+v, expect carfile %s with %d blocks", exported, cids[0].String(), len(cids))
+	}
+
+	dst := newImportBlock(t, &importScheduler{})
+	imported, err := dst.ImportCarfile(ctx, exportPath, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if imported.CarfileCid != exported.CarfileCid || imported.Blocks != exported.Blocks || imported.TotalSize != exported.TotalSize {
+		t.Fatalf("import result %+v, expect the same as export %+v", imported, exported)
+	}
+
+	for _, c := range cids {
+		srcData, err := src.getBlockWithCID(c.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dstData, err := dst.getBlockWithCID(c.String())
+		if err != nil || !bytes.Equal(srcData, dstData) {
+			t.Fatalf("block %s is not the same after import, error %v", c.String(), err)
+		}
+	}
+
+	// export fails with the missing block
+	if err := dst.deleteBlock(cids[2].String()); err != nil {
+		t.Fatal(err)
+	}
+
+	var missingErr *MissingBlocksError
+	_, err = dst.WriteCarfile(ctx, cids[0], &bytes.Buffer{})
+	if !errors.As(err, &missingErr) || len(missingErr.Cids) != 1 || missingErr.Cids[0] != cids[2].String() {
+		t.Fatalf("export error %v, expect missing block %s", err, cids[2].String())
+	}
+}
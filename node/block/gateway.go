@@ -0,0 +1,105 @@
+package block
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	uio "github.com/ipfs/go-unixfs/io"
+)
+
+// ResolvePath resolve the UnixFS path from root, return the cids of nodes on the path,
+// the first one is root and the last one is target of path
+func (block *Block) ResolvePath(ctx context.Context, root cid.Cid, segments []string) ([]cid.Cid, error) {
+	dagService := newStoreDAGService(block)
+
+	node, err := dagService.Get(ctx, root)
+	if err != nil {
+		return nil, block.missingBlocksError(root, err)
+	}
+
+	cids := []cid.Cid{root}
+	for _, name := range segments {
+		if name == "" {
+			continue
+		}
+
+		dir, err := uio.NewDirectoryFromNode(dagService, node)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %s in %s error:%s", name, node.Cid().String(), err.Error())
+		}
+
+		node, err = dir.Find(ctx, name)
+		if err != nil {
+			return nil, block.missingBlocksError(root, err)
+		}
+
+		cids = append(cids, node.Cid())
+	}
+
+	return cids, nil
+}
+
+// OpenFile return reader of UnixFS file, DAG of file is checked before the first open,
+// return MissingBlocksError if any block is missing
+func (block *Block) OpenFile(ctx context.Context, target cid.Cid) (uio.DagReader, error) {
+	dagService := newStoreDAGService(block)
+
+	node, err := dagService.Get(ctx, target)
+	if err != nil {
+		return nil, block.missingBlocksError(target, err)
+	}
+
+	reader, err := uio.NewDagReader(ctx, node, dagService)
+	if err != nil {
+		return nil, err
+	}
+
+	err = block.checkFileAvailable(ctx, target)
+	if err != nil {
+		reader.Close() //nolint:errcheck
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+// checkFileAvailable walk the DAG of file only once, so the range requests of file are not O(file),
+// the result is kept until any block is deleted
+func (block *Block) checkFileAvailable(ctx context.Context, target cid.Cid) error {
+	generation := atomic.LoadUint64(&block.deleteGeneration)
+	if checked, ok := block.availableFiles.Load(target.String()); ok && checked.(uint64) == generation {
+		return nil
+	}
+
+	_, err := block.walkCarfile(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	block.availableFiles.Store(target.String(), generation)
+	return nil
+}
+
+// invalidateAvailableFiles is called after block was deleted, the files will be checked again when open
+func (block *Block) invalidateAvailableFiles() {
+	atomic.AddUint64(&block.deleteGeneration, 1)
+
+	block.availableFiles.Range(func(key, value interface{}) bool {
+		block.availableFiles.Delete(key)
+		return true
+	})
+}
+
+// missingBlocksError convert the not found error of node to MissingBlocksError
+func (block *Block) missingBlocksError(root cid.Cid, err error) error {
+	var notFound format.ErrNotFound
+	if errors.As(err, &notFound) {
+		return &MissingBlocksError{CarfileCid: root.String(), Cids: []string{notFound.Cid.String()}}
+	}
+
+	return err
+}
@@ -0,0 +1,118 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	chunker "github.com/ipfs/go-ipfs-chunker"
+	"github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+	"github.com/ipfs/go-unixfs/importer/balanced"
+	ihelper "github.com/ipfs/go-unixfs/importer/helpers"
+	uio "github.com/ipfs/go-unixfs/io"
+	"github.com/linguohua/titan/blockstore"
+)
+
+func TestGatewayFile(t *testing.T) {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("titan gateway "), 1024)
+
+	dagService := mdtest.Mock()
+	params := ihelper.DagBuilderParams{Dagserv: dagService, Maxlinks: ihelper.DefaultLinksPerBlock, RawLeaves: true, CidBuilder: merkledag.V1CidPrefix()}
+	builder, err := params.New(chunker.NewSizeSplitter(bytes.NewReader(data), 1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := balanced.Layout(builder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := uio.NewDirectory(dagService)
+	dir.SetCidBuilder(merkledag.V1CidPrefix())
+	if err := dir.AddChild(ctx, "titan.txt", file); err != nil {
+		t.Fatal(err)
+	}
+
+	dirNode, err := dir.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	bs := blockstore.NewBlockStore(t.TempDir(), "FileStore")
+	block := NewBlock(ds, bs, nil, NewBitswap(nil), nil, "http://127.0.0.1:5001", 0)
+
+	// copy DAG of directory to block store
+	stack := []cid.Cid{dirNode.Cid()}
+	if err := dagService.Add(ctx, dirNode); err != nil {
+		t.Fatal(err)
+	}
+	for fid := 1; len(stack) > 0; fid++ {
+		node, err := dagService.Get(ctx, stack[len(stack)-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		stack = stack[:len(stack)-1]
+
+		if err := block.saveBlock(ctx, node.RawData(), node.Cid().String(), fmt.Sprintf("%d", fid)); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, link := range node.Links() {
+			stack = append(stack, link.Cid)
+		}
+	}
+
+	pathCids, err := block.ResolvePath(ctx, dirNode.Cid(), []string{"titan.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pathCids) != 2 || !pathCids[1].Equals(file.Cid()) {
+		t.Fatalf("resolve path %v, expect target %s", pathCids, file.Cid().String())
+	}
+
+	if _, err := block.ResolvePath(ctx, dirNode.Cid(), []string{"none.txt"}); err == nil {
+		t.Fatal("resolve not exist path should fail")
+	}
+
+	reader, err := block.OpenFile(ctx, file.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := io.ReadAll(reader)
+	reader.Close() //nolint:errcheck
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Fatalf("read %d bytes, expect %d bytes", len(got), len(data))
+	}
+
+	// availability of file is cached, the DAG is not walked again
+	if _, ok := block.availableFiles.Load(file.Cid().String()); !ok {
+		t.Fatalf("availability of file %s is not cached", file.Cid().String())
+	}
+
+	// file is partially available after a leaf is deleted
+	leaf := file.Links()[0].Cid
+	if err := block.deleteBlock(leaf.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	var missingErr *MissingBlocksError
+	if _, err := block.OpenFile(ctx, file.Cid()); !errors.As(err, &missingErr) || len(missingErr.Cids) != 1 {
+		t.Fatalf("open partial file error %v, expect one missing block", err)
+	}
+}
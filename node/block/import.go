@@ -0,0 +1,379 @@
+package block
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	chunker "github.com/ipfs/go-ipfs-chunker"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs/importer/balanced"
+	ihelper "github.com/ipfs/go-unixfs/importer/helpers"
+	uio "github.com/ipfs/go-unixfs/io"
+	car "github.com/ipld/go-car/v2"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/helper"
+)
+
+// number of blocks buffered in memory before allocate fid and save to block store,
+// also the number of blocks report to scheduler in one request
+const importBlockBatch = 100
+
+// blockImporter save the imported blocks to block store batch by batch,
+// fid of every batch are allocated by scheduler
+type blockImporter struct {
+	block *Block
+	batch []blocks.Block
+	// hash of imported blocks, avoid import duplicate block
+	imported map[string]struct{}
+	// saved blocks in import order
+	blockInfos []api.BlockCacheInfo
+	totalSize  int64
+	// fid of saved blocks before import, empty if block is new, for rollback
+	oldFids map[string]string
+}
+
+// ImportCarfile import CAR file or directory to block store,
+// CARv1 and CARv2 file must have only one root, directory is chunked into UnixFS.
+// Blocks are reported to scheduler with CacheResult, as a cache of carfile in this node
+func (block *Block) ImportCarfile(ctx context.Context, path string, expiredTime time.Time) (api.ImportCarfileResult, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return api.ImportCarfileResult{}, err
+	}
+
+	importer := &blockImporter{block: block, imported: make(map[string]struct{}), oldFids: make(map[string]string)}
+
+	var root cid.Cid
+	if info.IsDir() {
+		root, err = importer.importDirectory(ctx, path)
+	} else {
+		root, err = importer.importCarFile(ctx, path)
+	}
+	if err == nil {
+		err = importer.flush(ctx)
+	}
+	if err != nil {
+		log.Errorf("ImportCarfile, import %s error:%s", path, err.Error())
+		importer.rollback(ctx)
+		return api.ImportCarfileResult{}, err
+	}
+
+	cacheInfo, err := importer.registerBlocks(ctx, root, expiredTime)
+	if err != nil {
+		log.Errorf("ImportCarfile, register blocks of %s error:%s", root.String(), err.Error())
+		importer.rollback(ctx)
+		return api.ImportCarfileResult{}, err
+	}
+
+	importer.reportBlocks(root, cacheInfo)
+
+	log.Infof("ImportCarfile, import %s as carfile %s, cacheID %s, blocks %d, size %d", path, root.String(), cacheInfo.CacheID, len(importer.blockInfos), importer.totalSize)
+
+	return api.ImportCarfileResult{CarfileCid: root.String(), CacheID: cacheInfo.CacheID, Blocks: len(importer.blockInfos), TotalSize: importer.totalSize}, nil
+}
+
+func (importer *blockImporter) importCarFile(ctx context.Context, path string) (cid.Cid, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return cid.Undef, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	reader, err := car.NewBlockReader(f)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	if len(reader.Roots) != 1 {
+		return cid.Undef, fmt.Errorf("car file must have one root, but has %d roots", len(reader.Roots))
+	}
+
+	for {
+		b, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return cid.Undef, err
+		}
+
+		err = importer.add(ctx, b)
+		if err != nil {
+			return cid.Undef, err
+		}
+	}
+
+	root := reader.Roots[0]
+	if _, exist := importer.imported[root.Hash().String()]; !exist {
+		return cid.Undef, fmt.Errorf("root %s not in car file", root.String())
+	}
+
+	return root, nil
+}
+
+// chunk files into UnixFS with raw leaves and cid v1, return the root of directory
+func (importer *blockImporter) importDirectory(ctx context.Context, path string) (cid.Cid, error) {
+	node, err := importer.importPath(ctx, path, newImportDAGService(importer))
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	return node.Cid(), nil
+}
+
+func (importer *blockImporter) importPath(ctx context.Context, path string, dagService format.DAGService) (format.Node, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return importer.importFile(path, dagService)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := uio.NewDirectory(dagService)
+	dir.SetCidBuilder(merkledag.V1CidPrefix())
+
+	for _, entry := range entries {
+		node, err := importer.importPath(ctx, filepath.Join(path, entry.Name()), dagService)
+		if err != nil {
+			return nil, err
+		}
+
+		err = dir.AddChild(ctx, entry.Name(), node)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	node, err := dir.GetNode()
+	if err != nil {
+		return nil, err
+	}
+
+	return node, dagService.Add(ctx, node)
+}
+
+func (importer *blockImporter) importFile(path string, dagService format.DAGService) (format.Node, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	params := ihelper.DagBuilderParams{
+		Dagserv:    dagService,
+		Maxlinks:   ihelper.DefaultLinksPerBlock,
+		RawLeaves:  true,
+		CidBuilder: merkledag.V1CidPrefix(),
+	}
+
+	builder, err := params.New(chunker.DefaultSplitter(f))
+	if err != nil {
+		return nil, err
+	}
+
+	return balanced.Layout(builder)
+}
+
+func (importer *blockImporter) add(ctx context.Context, b blocks.Block) error {
+	hash := b.Cid().Hash().String()
+	if _, exist := importer.imported[hash]; exist {
+		return nil
+	}
+	importer.imported[hash] = struct{}{}
+
+	importer.batch = append(importer.batch, b)
+	if len(importer.batch) < importBlockBatch {
+		return nil
+	}
+
+	return importer.flush(ctx)
+}
+
+// getUnsaved return the block in batch, which is not saved to block store yet
+func (importer *blockImporter) getUnsaved(c cid.Cid) (blocks.Block, bool) {
+	for _, b := range importer.batch {
+		if b.Cid().Equals(c) {
+			return b, true
+		}
+	}
+
+	return nil, false
+}
+
+// allocate fid for blocks in batch, then save them to block store
+func (importer *blockImporter) flush(ctx context.Context) error {
+	if len(importer.batch) == 0 {
+		return nil
+	}
+
+	startFid, err := importer.allocateFids(len(importer.batch))
+	if err != nil {
+		return err
+	}
+
+	for i, b := range importer.batch {
+		fid := startFid + i
+		oldFid, _ := importer.block.getFIDFromCID(b.Cid().String())
+
+		err = importer.block.saveBlock(ctx, b.RawData(), b.Cid().String(), fmt.Sprintf("%d", fid))
+		if err != nil {
+			return err
+		}
+		importer.oldFids[b.Cid().String()] = oldFid
+
+		importer.blockInfos = append(importer.blockInfos, api.BlockCacheInfo{Cid: b.Cid().String(), Fid: fid})
+		importer.totalSize += int64(len(b.RawData()))
+	}
+
+	importer.batch = importer.batch[:0]
+	return nil
+}
+
+func (importer *blockImporter) allocateFids(count int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), helper.SchedulerApiTimeout*time.Second)
+	defer cancel()
+
+	return importer.block.scheduler.NodeAllocateFids(ctx, count)
+}
+
+// rollback delete the blocks saved by a failed import,
+// the blocks already in block store before import get back their old fids
+func (importer *blockImporter) rollback(ctx context.Context) {
+	for cidStr, oldFid := range importer.oldFids {
+		if oldFid == "" {
+			err := importer.block.deleteBlock(cidStr)
+			if err != nil {
+				log.Errorf("rollback, delete block %s error:%s", cidStr, err.Error())
+			}
+			continue
+		}
+
+		target, err := cid.Decode(cidStr)
+		if err != nil {
+			continue
+		}
+
+		err = importer.block.updateCidAndFid(ctx, target, oldFid)
+		if err != nil {
+			log.Errorf("rollback, restore block %s fid %s error:%s", cidStr, oldFid, err.Error())
+		}
+	}
+
+	importer.oldFids = make(map[string]string)
+}
+
+// tell scheduler the imported blocks batch by batch, root block is the first one
+func (importer *blockImporter) registerBlocks(ctx context.Context, root cid.Cid, expiredTime time.Time) (api.ImportCacheInfo, error) {
+	for i, blockInfo := range importer.blockInfos {
+		if blockInfo.Cid == root.String() {
+			importer.blockInfos[0], importer.blockInfos[i] = importer.blockInfos[i], importer.blockInfos[0]
+			break
+		}
+	}
+
+	cacheInfo := api.ImportCacheInfo{}
+	for start := 0; start < len(importer.blockInfos); start += importBlockBatch {
+		end := start + importBlockBatch
+		if end > len(importer.blockInfos) {
+			end = len(importer.blockInfos)
+		}
+
+		info := api.ImportCarfileInfo{CarfileCid: root.String(), CacheID: cacheInfo.CacheID, ExpiredTime: expiredTime, Blocks: importer.blockInfos[start:end]}
+
+		var err error
+		cacheInfo, err = importer.importCarfileInfo(info)
+		if err != nil {
+			return api.ImportCacheInfo{}, err
+		}
+	}
+
+	return cacheInfo, nil
+}
+
+func (importer *blockImporter) importCarfileInfo(info api.ImportCarfileInfo) (api.ImportCacheInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), helper.SchedulerApiTimeout*time.Second)
+	defer cancel()
+
+	return importer.block.scheduler.NodeImportCarfile(ctx, info)
+}
+
+// report every imported block with CacheResult, so scheduler records this node holding the carfile
+func (importer *blockImporter) reportBlocks(root cid.Cid, cacheInfo api.ImportCacheInfo) {
+	block := importer.block
+	carfileHash := root.Hash().String()
+
+	for _, blockInfo := range importer.blockInfos {
+		bStat := blockStat{cid: blockInfo.Cid, carFileHash: carfileHash, CacheID: cacheInfo.CacheID}
+
+		data, err := block.getBlockWithCID(blockInfo.Cid)
+		if err != nil {
+			block.cacheResultWithError(bStat, err)
+			continue
+		}
+
+		links, err := getLinks(block, data, blockInfo.Cid)
+		if err != nil {
+			block.cacheResultWithError(bStat, err)
+			continue
+		}
+
+		cids := make([]string, 0, len(links))
+		for _, link := range links {
+			cids = append(cids, link.Cid.String())
+			bStat.linksSize += link.Size
+		}
+		bStat.links = cids
+		bStat.blockSize = len(data)
+
+		target, err := cid.Decode(blockInfo.Cid)
+		if err == nil {
+			block.setBlockMetaCarfile(target.Hash().String(), carfileHash, cacheInfo.Reliability)
+		}
+
+		block.cacheResult(bStat, nil)
+	}
+}
+
+// importDAGService save nodes created by UnixFS importer with blockImporter,
+// nodes are read from the batch of importer or block store
+type importDAGService struct {
+	*storeDAGService
+	importer *blockImporter
+}
+
+func newImportDAGService(importer *blockImporter) *importDAGService {
+	dagService := newStoreDAGService(importer.block)
+	dagService.unsaved = importer.getUnsaved
+
+	return &importDAGService{storeDAGService: dagService, importer: importer}
+}
+
+func (dagService *importDAGService) Add(ctx context.Context, node format.Node) error {
+	return dagService.importer.add(ctx, node)
+}
+
+func (dagService *importDAGService) AddMany(ctx context.Context, nodes []format.Node) error {
+	for _, node := range nodes {
+		err := dagService.importer.add(ctx, node)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
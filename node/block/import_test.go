@@ -0,0 +1,214 @@
+package block
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	carv1 "github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/blockstore"
+	"github.com/linguohua/titan/node/device"
+)
+
+// importScheduler allocate fids and record the imported blocks like scheduler
+type importScheduler struct {
+	api.SchedulerStub
+	maxFid     int
+	importErr  error
+	registered []api.BlockCacheInfo
+	results    []api.CacheResultInfo
+}
+
+func (s *importScheduler) NodeAllocateFids(ctx context.Context, count int) (int, error) {
+	s.maxFid += count
+	return s.maxFid - count + 1, nil
+}
+
+func (s *importScheduler) NodeImportCarfile(ctx context.Context, info api.ImportCarfileInfo) (api.ImportCacheInfo, error) {
+	if s.importErr != nil {
+		return api.ImportCacheInfo{}, s.importErr
+	}
+
+	s.registered = append(s.registered, info.Blocks...)
+	return api.ImportCacheInfo{CacheID: "cache", Reliability: 2}, nil
+}
+
+func (s *importScheduler) CacheResult(ctx context.Context, deviceID string, resultInfo api.CacheResultInfo) error {
+	s.results = append(s.results, resultInfo)
+	return nil
+}
+
+func newImportBlock(t *testing.T, scheduler *importScheduler) *Block {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	bs := blockstore.NewBlockStore(t.TempDir(), "FileStore")
+	block := NewBlock(ds, bs, scheduler, NewBitswap(nil), device.NewDevice("device", "", "", 0, 0, bs), "http://127.0.0.1:5001", 0)
+	block.quota = &storageQuota{max: 1 << 20, policy: EvictPolicyLRU, loaded: true, lock: &sync.Mutex{}, evictedAlarm: make(chan struct{}, 1)}
+
+	return block
+}
+
+// writeCarFile write a root block with 2 raw leaves to CARv1 file
+func writeCarFile(t *testing.T) (string, []cid.Cid) {
+	leaf1 := merkledag.NewRawNode([]byte("titan import leaf 1"))
+	leaf2 := merkledag.NewRawNode([]byte("titan import leaf 2"))
+
+	root := merkledag.NodeWithData([]byte("titan import root"))
+	root.SetCidBuilder(merkledag.V1CidPrefix())
+	if err := root.AddRawLink("leaf1", &format.Link{Cid: leaf1.Cid(), Size: uint64(len(leaf1.RawData()))}); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.AddRawLink("leaf2", &format.Link{Cid: leaf2.Cid(), Size: uint64(len(leaf2.RawData()))}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "import.car")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	if err := carv1.WriteHeader(&carv1.CarHeader{Roots: []cid.Cid{root.Cid()}, Version: 1}, f); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, b := range []blocks.Block{leaf1, root, leaf2} {
+		if err := carutil.LdWrite(f, b.Cid().Bytes(), b.RawData()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return path, []cid.Cid{root.Cid(), leaf1.Cid(), leaf2.Cid()}
+}
+
+func TestImportCarFile(t *testing.T) {
+	scheduler := &importScheduler{}
+	block := newImportBlock(t, scheduler)
+	path, cids := writeCarFile(t)
+
+	result, err := block.ImportCarfile(context.Background(), path, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.CarfileCid != cids[0].String() || result.CacheID != "cache" || result.Blocks != len(cids) {
+		t.Fatalf("import result %+v, expect carfile %s with %d blocks", result, cids[0].String(), len(cids))
+	}
+
+	if len(scheduler.registered) != len(cids) || scheduler.registered[0].Cid != cids[0].String() {
+		t.Fatalf("registered blocks %v, expect root block first", scheduler.registered)
+	}
+
+	for _, blockInfo := range scheduler.registered {
+		fid, err := block.getFIDFromCID(blockInfo.Cid)
+		if err != nil || fid != fmt.Sprintf("%d", blockInfo.Fid) {
+			t.Fatalf("block %s fid %s, expect %d, error %v", blockInfo.Cid, fid, blockInfo.Fid, err)
+		}
+	}
+
+	if len(scheduler.results) != len(cids) {
+		t.Fatalf("report %d blocks, expect %d", len(scheduler.results), len(cids))
+	}
+
+	for _, r := range scheduler.results {
+		if !r.IsOK || r.CacheID != "cache" || r.CarFileHash != cids[0].Hash().String() {
+			t.Fatalf("cache result %+v", r)
+		}
+
+		if r.Cid == cids[0].String() && len(r.Links) != 2 {
+			t.Fatalf("root block links %v, expect 2 leaves", r.Links)
+		}
+	}
+
+	meta, err := block.getBlockMeta(cids[1].Hash().String())
+	if err != nil || meta.Reliability != 2 {
+		t.Fatalf("block meta %+v, error %v, expect reliability of scheduler", meta, err)
+	}
+}
+
+func TestImportDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("titan import file a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("titan import file b"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler := &importScheduler{}
+	block := newImportBlock(t, scheduler)
+
+	result, err := block.ImportCarfile(context.Background(), dir, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// root dir, sub dir, a.txt and b.txt
+	if result.Blocks != 4 || len(scheduler.results) != 4 {
+		t.Fatalf("import %d blocks, report %d blocks, expect 4", result.Blocks, len(scheduler.results))
+	}
+
+	data, err := block.getBlockWithCID(result.CarfileCid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := merkledag.DecodeProtobuf(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := root.GetNodeLink("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := root.GetNodeLink("sub"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportRollback(t *testing.T) {
+	scheduler := &importScheduler{importErr: errors.New("import refused")}
+	block := newImportBlock(t, scheduler)
+	path, cids := writeCarFile(t)
+
+	// leaf1 was cached before import
+	leaf1 := merkledag.NewRawNode([]byte("titan import leaf 1"))
+	if err := block.saveBlock(context.Background(), leaf1.RawData(), leaf1.Cid().String(), "100"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := block.ImportCarfile(context.Background(), path, time.Now().Add(time.Hour)); err == nil {
+		t.Fatal("import should fail")
+	}
+
+	fid, err := block.getFIDFromCID(cids[1].String())
+	if err != nil || fid != "100" {
+		t.Fatalf("block cached before import fid %s, error %v, expect 100", fid, err)
+	}
+
+	for _, c := range []cid.Cid{cids[0], cids[2]} {
+		if exist, _ := block.blockStore.Has(c.Hash().String()); exist {
+			t.Fatalf("block %s should be deleted", c.String())
+		}
+
+		if _, err := block.getFIDFromCID(c.String()); err == nil {
+			t.Fatalf("fid of block %s should be deleted", c.String())
+		}
+	}
+}
@@ -15,8 +15,8 @@ import (
 
 type IPFS struct{}
 
-func (ipfs *IPFS) loadBlocks(block *Block, reqs []*delayReq) ([]blocks.Block, error) {
-	return getBlocksWithDelayReqs(reqs, block)
+func (ipfs *IPFS) loadBlocks(ctx context.Context, block *Block, reqs []*delayReq) ([]blocks.Block, error) {
+	return getBlocksWithDelayReqs(ctx, reqs, block)
 }
 
 func (ipfs *IPFS) syncData(block *Block, reqs map[int]string) error {
@@ -48,7 +48,7 @@ func (ipfs *IPFS) syncData(block *Block, reqs map[int]string) error {
 	}
 
 	for _, group := range groups {
-		blocks, err := getBlocksFromIPFS(block, group)
+		blocks, err := getBlocksFromIPFS(ctx, block, group)
 		if err != nil {
 			log.Errorf("syncData getBlocksWithHttp err %v", err)
 			return err
@@ -70,8 +70,26 @@ func (ipfs *IPFS) syncData(block *Block, reqs map[int]string) error {
 	return nil
 }
 
-func getBlockWithIPFSApi(block *Block, cidStr string) (blocks.Block, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), helper.BlockDownloadTimeout*time.Second)
+func (ipfs *IPFS) loadRawBlock(ctx context.Context, block *Block, req *delayReq) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, helper.BlockDownloadTimeout*time.Second)
+	defer cancel()
+
+	// Block().Get will buffer the whole block, use the response body directly
+	resp, err := block.ipfsApi.Request("block/get", req.blockInfo.Cid).Send(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Close()
+
+	if resp.Error != nil {
+		return 0, resp.Error
+	}
+
+	return block.saveBlockStream(ctx, resp.Output, req.blockInfo.Cid, fmt.Sprintf("%d", req.blockInfo.Fid))
+}
+
+func getBlockWithIPFSApi(ctx context.Context, block *Block, cidStr string) (blocks.Block, error) {
+	ctx, cancel := context.WithTimeout(ctx, helper.BlockDownloadTimeout*time.Second)
 	defer cancel()
 
 	reader, err := block.ipfsApi.Block().Get(ctx, path.New(cidStr))
@@ -97,7 +115,7 @@ func getBlockWithIPFSApi(block *Block, cidStr string) (blocks.Block, error) {
 	return basicBlock, nil
 }
 
-func getBlocksFromIPFS(block *Block, cids []string) ([]blocks.Block, error) {
+func getBlocksFromIPFS(ctx context.Context, block *Block, cids []string) ([]blocks.Block, error) {
 	startTime := time.Now()
 	blks := make([]blocks.Block, 0, len(cids))
 
@@ -109,7 +127,7 @@ func getBlocksFromIPFS(block *Block, cids []string) ([]blocks.Block, error) {
 
 		go func() {
 			defer wg.Done()
-			b, err := getBlockWithIPFSApi(block, cidStr)
+			b, err := getBlockWithIPFSApi(ctx, block, cidStr)
 			if err != nil {
 				log.Errorf("getBlockWithWaitGroup error:%s", err.Error())
 				return
@@ -123,13 +141,13 @@ func getBlocksFromIPFS(block *Block, cids []string) ([]blocks.Block, error) {
 	return blks, nil
 }
 
-func getBlocksWithDelayReqs(reqs []*delayReq, block *Block) ([]blocks.Block, error) {
+func getBlocksWithDelayReqs(ctx context.Context, reqs []*delayReq, block *Block) ([]blocks.Block, error) {
 	cids := make([]string, 0, len(reqs))
 
 	for _, req := range reqs {
 		cids = append(cids, req.blockInfo.Cid)
 	}
 
-	return getBlocksFromIPFS(block, cids)
+	return getBlocksFromIPFS(ctx, block, cids)
 
 }
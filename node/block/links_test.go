@@ -0,0 +1,97 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/fluent"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/linguohua/titan/api"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// memoryLoader load blocks from memory
+type memoryLoader struct {
+	blocks map[string]blocks.Block
+}
+
+func (loader *memoryLoader) loadBlocks(ctx context.Context, block *Block, reqs []*delayReq) ([]blocks.Block, error) {
+	blks := make([]blocks.Block, 0, len(reqs))
+	for _, req := range reqs {
+		if b, exist := loader.blocks[req.blockInfo.Cid]; exist {
+			blks = append(blks, b)
+		}
+	}
+
+	return blks, nil
+}
+
+func (loader *memoryLoader) syncData(block *Block, reqs map[int]string) error {
+	return nil
+}
+
+// newLinksBlock encode a map with a link and a list of link with codec
+func newLinksBlock(t *testing.T, codecType uint64, encoder codec.Encoder, leaf1, leaf2 cid.Cid) blocks.Block {
+	node := fluent.MustBuildMap(basicnode.Prototype.Map, 2, func(ma fluent.MapAssembler) {
+		ma.AssembleEntry("leaf").AssignLink(cidlink.Link{Cid: leaf1})
+		ma.AssembleEntry("list").CreateList(1, func(la fluent.ListAssembler) {
+			la.AssembleValue().AssignLink(cidlink.Link{Cid: leaf2})
+		})
+	})
+
+	var buf bytes.Buffer
+	if err := encoder(node, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := cid.Prefix{Version: 1, Codec: codecType, MhType: mh.SHA2_256, MhLength: -1}.Sum(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := blocks.NewBlockWithCid(buf.Bytes(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestCacheLinksOfCodecs(t *testing.T) {
+	leaf1 := merkledag.NewRawNode([]byte("titan cbor leaf 1"))
+	leaf2 := merkledag.NewRawNode([]byte("titan cbor leaf 2"))
+
+	for name, root := range map[string]blocks.Block{
+		"dag-cbor": newLinksBlock(t, cid.DagCBOR, dagcbor.Encode, leaf1.Cid(), leaf2.Cid()),
+		"dag-json": newLinksBlock(t, cid.DagJSON, dagjson.Encode, leaf1.Cid(), leaf2.Cid()),
+	} {
+		scheduler := &importScheduler{}
+		block := newImportBlock(t, scheduler)
+		block.blockLoader = &memoryLoader{blocks: map[string]blocks.Block{root.Cid().String(): root}}
+
+		req := &delayReq{blockInfo: api.BlockCacheInfo{Cid: root.Cid().String(), Fid: 1}, carFileHash: root.Cid().Hash().String(), CacheID: "cache"}
+		block.loadBlocks(context.Background(), []*delayReq{req})
+
+		if len(scheduler.results) != 1 || !scheduler.results[0].IsOK {
+			t.Fatalf("%s cache results %+v, expect root block cached", name, scheduler.results)
+		}
+
+		result := scheduler.results[0]
+		if result.BlockSize != len(root.RawData()) {
+			t.Fatalf("%s block size %d, expect %d", name, result.BlockSize, len(root.RawData()))
+		}
+
+		links := map[string]bool{leaf1.Cid().String(): true, leaf2.Cid().String(): true}
+		if len(result.Links) != len(links) || !links[result.Links[0]] || !links[result.Links[1]] {
+			t.Fatalf("%s links %v, expect %s and %s", name, result.Links, leaf1.Cid().String(), leaf2.Cid().String())
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package block
+
+import (
+	"container/list"
+	"context"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/helper"
+)
+
+// loaderWorker load one batch of blocks at a time
+type loaderWorker struct {
+	id        int
+	reqs      []*delayReq
+	startTime time.Time
+	// carfile of the loading batch, cancel abort the loading of batch
+	carfileHash string
+	cancel      context.CancelFunc
+}
+
+func (block *Block) startBlockLoaders(count int) {
+	if block.blockLoader == nil {
+		log.Panic("block.block == nil")
+	}
+
+	if count <= 0 {
+		count = 1
+	}
+
+	for i := 0; i < count; i++ {
+		worker := &loaderWorker{id: i}
+		block.loaderWorkers = append(block.loaderWorkers, worker)
+		go block.runLoaderWorker(worker)
+	}
+}
+
+func (block *Block) runLoaderWorker(worker *loaderWorker) {
+	for {
+		ctx, reqs := block.nextCacheReqs(worker)
+
+		block.loadBlocks(ctx, reqs)
+		block.removeCacheReqs(reqs)
+
+		block.queueLock.Lock()
+		worker.cancel()
+		worker.reqs = nil
+		worker.carfileHash = ""
+		worker.cancel = nil
+		block.queueLock.Unlock()
+	}
+}
+
+// wake up all workers to load blocks in queue
+func (block *Block) notifyBlockLoader() {
+	block.queueLock.Lock()
+	defer block.queueLock.Unlock()
+
+	block.queueCond.Broadcast()
+}
+
+// nextCacheReqs wait until there is a carfile in queue, then take a batch of it.
+// Carfile with higher priority is taken first, carfiles with the same priority take turns,
+// the returned ctx is cancelled if caching of the carfile is cancelled
+func (block *Block) nextCacheReqs(worker *loaderWorker) (context.Context, []*delayReq) {
+	block.queueLock.Lock()
+	defer block.queueLock.Unlock()
+
+	element := block.selectCarfile()
+	for element == nil {
+		block.queueCond.Wait()
+		element = block.selectCarfile()
+	}
+
+	carfile := element.Value.(*carfile)
+
+	doLen := len(carfile.delayReqs)
+	if doLen > helper.Batch {
+		doLen = helper.Batch
+	}
+
+	reqs := carfile.removeReq(doLen)
+	if len(carfile.delayReqs) == 0 {
+		block.carfileList.Remove(element)
+	} else {
+		// let other carfiles with the same priority go first
+		block.carfileList.MoveToBack(element)
+	}
+
+	log.Infof("loader worker %d, carfile hash:%s, load %d blocks, remain %d", worker.id, carfile.carfileHash, len(reqs), len(carfile.delayReqs))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	worker.reqs = reqs
+	worker.startTime = time.Now()
+	worker.carfileHash = carfile.carfileHash
+	worker.cancel = cancel
+
+	return ctx, reqs
+}
+
+// cancelLoading abort the loading batches of carfile, must hold queueLock
+func (block *Block) cancelLoading(carfileHash string) {
+	for _, worker := range block.loaderWorkers {
+		if worker.cancel != nil && worker.carfileHash == carfileHash {
+			log.Infof("cancel loading of carfile %s in loader worker %d", carfileHash, worker.id)
+			worker.cancel()
+		}
+	}
+}
+
+// must hold queueLock
+func (block *Block) selectCarfile() *list.Element {
+	var selected *list.Element
+	priority := 0
+	for e := block.carfileList.Front(); e != nil; e = e.Next() {
+		carfile := e.Value.(*carfile)
+		if len(carfile.delayReqs) == 0 {
+			continue
+		}
+
+		if block.waitQueueReport && carfile.resumed {
+			continue
+		}
+
+		if selected == nil || carfile.priority > priority {
+			selected = e
+			priority = carfile.priority
+		}
+	}
+
+	return selected
+}
+
+func (block *Block) getLoadingBlockNum() int {
+	block.queueLock.Lock()
+	defer block.queueLock.Unlock()
+
+	count := 0
+	for _, worker := range block.loaderWorkers {
+		count += len(worker.reqs)
+	}
+
+	return count
+}
+
+// getLoadingRetryNum return the sum of retry count of the loading blocks
+func (block *Block) getLoadingRetryNum() int {
+	block.queueLock.Lock()
+	defer block.queueLock.Unlock()
+
+	retryNum := 0
+	for _, worker := range block.loaderWorkers {
+		for _, req := range worker.reqs {
+			retryNum += req.count
+		}
+	}
+
+	return retryNum
+}
+
+// return the progress of every worker and the blocks waiting in queue
+func (block *Block) getCachingBlockStats() []api.CachingBlockStat {
+	block.queueLock.Lock()
+	defer block.queueLock.Unlock()
+
+	stats := make([]api.CachingBlockStat, 0)
+	for _, worker := range block.loaderWorkers {
+		costTime := int(time.Since(worker.startTime) / time.Millisecond)
+		for _, req := range worker.reqs {
+			stat := api.CachingBlockStat{Cid: req.blockInfo.Cid, Worker: worker.id, CostTime: costTime}
+
+			hash, err := helper.CIDString2HashString(req.blockInfo.Cid)
+			if err == nil {
+				if exist, _ := block.blockStore.Has(hash); exist {
+					stat.DownloadPercent = 100
+				}
+			}
+
+			stats = append(stats, stat)
+		}
+	}
+
+	for e := block.carfileList.Front(); e != nil; e = e.Next() {
+		carfile := e.Value.(*carfile)
+		for _, req := range carfile.delayReqs {
+			stats = append(stats, api.CachingBlockStat{Cid: req.blockInfo.Cid, Worker: api.CachingWorkerWaiting})
+		}
+	}
+
+	return stats
+}
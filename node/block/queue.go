@@ -0,0 +1,216 @@
+package block
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/helper"
+)
+
+// cacheReq is the delayReq saved in datastore, so the cache queue can be resumed after restart
+type cacheReq struct {
+	BlockInfo     api.BlockCacheInfo
+	DownloadURL   string
+	DownloadToken string
+	CarfileHash   string
+	CacheID       string
+	Reliability   int
+	Priority      int
+	FromEdge      bool
+	// fingerprint of self-signed certificate of peer edge
+	CertFingerprint string
+}
+
+func (block *Block) saveCacheReqs(reqs []*delayReq) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	batch, err := block.ds.Batch(ctx)
+	if err != nil {
+		log.Errorf("saveCacheReqs, new batch error:%s", err.Error())
+		return
+	}
+
+	for _, req := range reqs {
+		value, err := json.Marshal(&cacheReq{
+			BlockInfo:       req.blockInfo,
+			DownloadURL:     req.downloadURL,
+			DownloadToken:   req.downloadToken,
+			CarfileHash:     req.carFileHash,
+			CacheID:         req.CacheID,
+			Reliability:     req.reliability,
+			Priority:        req.priority,
+			FromEdge:        req.fromEdge,
+			CertFingerprint: req.certFingerprint,
+		})
+		if err != nil {
+			log.Errorf("saveCacheReqs, marshal error:%s", err.Error())
+			continue
+		}
+
+		err = batch.Put(ctx, helper.NewKeyCacheReq(req.carFileHash, req.blockInfo.Fid), value)
+		if err != nil {
+			log.Errorf("saveCacheReqs, put error:%s", err.Error())
+		}
+	}
+
+	err = batch.Commit(ctx)
+	if err != nil {
+		log.Errorf("saveCacheReqs, commit error:%s", err.Error())
+	}
+}
+
+// remove reqs from datastore after they were done, no matter success or not
+func (block *Block) removeCacheReqs(reqs []*delayReq) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	batch, err := block.ds.Batch(ctx)
+	if err != nil {
+		log.Errorf("removeCacheReqs, new batch error:%s", err.Error())
+		return
+	}
+
+	for _, req := range reqs {
+		err = batch.Delete(ctx, helper.NewKeyCacheReq(req.carFileHash, req.blockInfo.Fid))
+		if err != nil {
+			log.Errorf("removeCacheReqs, delete error:%s", err.Error())
+		}
+	}
+
+	err = batch.Commit(ctx)
+	if err != nil {
+		log.Errorf("removeCacheReqs, commit error:%s", err.Error())
+	}
+}
+
+func (block *Block) removeCarfileCacheReqs(carfileHash string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results, err := block.ds.Query(ctx, query.Query{Prefix: helper.KeyCacheReqPrefix + carfileHash, KeysOnly: true})
+	if err != nil {
+		log.Errorf("removeCarfileCacheReqs, query error:%s", err.Error())
+		return
+	}
+
+	keys := make([]string, 0)
+	for {
+		r, exist := results.NextSync()
+		if !exist {
+			break
+		}
+		keys = append(keys, r.Key)
+	}
+
+	for _, key := range keys {
+		err = block.ds.Delete(ctx, datastore.NewKey(key))
+		if err != nil {
+			log.Errorf("removeCarfileCacheReqs, delete %s error:%s", key, err.Error())
+		}
+	}
+}
+
+// load the cache queue saved before restart,
+// the queue will be load after report to scheduler
+func (block *Block) loadCacheReqs() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results, err := block.ds.Query(ctx, query.Query{Prefix: helper.KeyCacheReqPrefix})
+	if err != nil {
+		log.Errorf("loadCacheReqs, query error:%s", err.Error())
+		return
+	}
+
+	block.queueLock.Lock()
+	defer block.queueLock.Unlock()
+
+	count := 0
+	for {
+		r, exist := results.NextSync()
+		if !exist {
+			break
+		}
+
+		saved := cacheReq{}
+		err = json.Unmarshal(r.Value, &saved)
+		if err != nil {
+			log.Errorf("loadCacheReqs, unmarshal %s error:%s", r.Key, err.Error())
+			continue
+		}
+
+		req := &delayReq{
+			blockInfo:       saved.BlockInfo,
+			downloadURL:     saved.DownloadURL,
+			downloadToken:   saved.DownloadToken,
+			carFileHash:     saved.CarfileHash,
+			CacheID:         saved.CacheID,
+			reliability:     saved.Reliability,
+			priority:        saved.Priority,
+			fromEdge:        saved.FromEdge,
+			certFingerprint: saved.CertFingerprint,
+		}
+		block.addReqsToCarfile(saved.CarfileHash, saved.Priority, []*delayReq{req})
+		block.getElementFromList(saved.CarfileHash).Value.(*carfile).resumed = true
+		count++
+	}
+
+	if count > 0 {
+		block.waitQueueReport = true
+		log.Infof("loadCacheReqs, resume %d blocks of %d carfiles", count, block.carfileList.Len())
+	}
+}
+
+// ReportCacheQueue report the resumed cache queue to scheduler after connect,
+// loader workers wait for the report before loading the resumed queue
+func (block *Block) ReportCacheQueue() {
+	// start loading even if report failed, scheduler will know the queue from cache results
+	defer block.startResumedQueue()
+
+	block.queueLock.Lock()
+	queue := make([]api.CacheQueueInfo, 0, block.carfileList.Len())
+	for e := block.carfileList.Front(); e != nil; e = e.Next() {
+		carfile := e.Value.(*carfile)
+
+		cacheIDs := make(map[string]int)
+		for _, req := range carfile.delayReqs {
+			cacheIDs[req.CacheID]++
+		}
+
+		for cacheID, count := range cacheIDs {
+			queue = append(queue, api.CacheQueueInfo{CarfileHash: carfile.carfileHash, CacheID: cacheID, BlockCount: count})
+		}
+	}
+	block.queueLock.Unlock()
+
+	if len(queue) == 0 {
+		return
+	}
+
+	stat, err := block.QueryCacheStat(context.Background())
+	if err != nil {
+		log.Errorf("ReportCacheQueue, QueryCacheStat error:%s", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), helper.SchedulerApiTimeout*time.Second)
+	defer cancel()
+
+	err = block.scheduler.NodeCacheQueueResumed(ctx, stat, queue)
+	if err != nil {
+		log.Errorf("ReportCacheQueue, NodeCacheQueueResumed error:%s", err.Error())
+	}
+}
+
+func (block *Block) startResumedQueue() {
+	block.queueLock.Lock()
+	defer block.queueLock.Unlock()
+
+	block.waitQueueReport = false
+	block.queueCond.Broadcast()
+}
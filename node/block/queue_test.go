@@ -0,0 +1,62 @@
+package block
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/blockstore"
+)
+
+func TestResumedQueueWaitReport(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	bs := blockstore.NewBlockStore(t.TempDir(), "FileStore")
+
+	saved := NewBlock(ds, bs, nil, NewBitswap(nil), nil, "http://127.0.0.1:5001", 0)
+	saved.saveCacheReqs([]*delayReq{{blockInfo: api.BlockCacheInfo{Cid: "resumed", Fid: 1}, carFileHash: "resumed", CacheID: "cache"}})
+
+	// restart, the saved queue is resumed
+	block := NewBlock(ds, bs, nil, NewBitswap(nil), nil, "http://127.0.0.1:5001", 0)
+
+	if !block.waitQueueReport {
+		t.Fatal("resumed queue should wait for report")
+	}
+
+	if e := block.selectCarfile(); e != nil {
+		t.Fatalf("select carfile %s before report, expect none", e.Value.(*carfile).carfileHash)
+	}
+
+	// new cache request is loaded before report
+	block.addReqsToCarfile("new", 0, []*delayReq{{blockInfo: api.BlockCacheInfo{Cid: "new", Fid: 2}, carFileHash: "new"}})
+	if e := block.selectCarfile(); e == nil || e.Value.(*carfile).carfileHash != "new" {
+		t.Fatal("new carfile should be selected before report")
+	}
+
+	block.carfileList.Remove(block.getElementFromList("new"))
+	block.startResumedQueue()
+
+	if e := block.selectCarfile(); e == nil || e.Value.(*carfile).carfileHash != "resumed" {
+		t.Fatal("resumed carfile should be selected after report")
+	}
+}
+
+func TestResumedQueueCertFingerprint(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	bs := blockstore.NewBlockStore(t.TempDir(), "FileStore")
+
+	saved := NewBlock(ds, bs, nil, NewBitswap(nil), nil, "http://127.0.0.1:5001", 0)
+	saved.saveCacheReqs([]*delayReq{{blockInfo: api.BlockCacheInfo{Cid: "edge", Fid: 1}, carFileHash: "edge", fromEdge: true, certFingerprint: "fingerprint"}})
+
+	// fingerprint of peer edge is kept after restart, so the resumed req can still load from it
+	block := NewBlock(ds, bs, nil, NewBitswap(nil), nil, "http://127.0.0.1:5001", 0)
+	e := block.getElementFromList("edge")
+	if e == nil || len(e.Value.(*carfile).delayReqs) != 1 {
+		t.Fatal("saved req of carfile edge should be resumed")
+	}
+
+	req := e.Value.(*carfile).delayReqs[0]
+	if !req.fromEdge || req.certFingerprint != "fingerprint" {
+		t.Fatalf("resumed req from edge %v, fingerprint %q, expect fingerprint of peer edge", req.fromEdge, req.certFingerprint)
+	}
+}
@@ -0,0 +1,416 @@
+package block
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/linguohua/titan/node/helper"
+)
+
+const (
+	// evict the block which was not downloaded for the longest time
+	EvictPolicyLRU = "lru"
+	// evict the block of carfile which need the lowest reliability
+	EvictPolicyReliability = "reliability"
+
+	// free at least 1/evictBatchDivisor of quota every time, avoid to evict on every block saving
+	evictBatchDivisor = 100
+)
+
+type blockMeta struct {
+	Size int
+	// unix time of block saved or last downloaded by user
+	LastAccess  int64
+	CarfileHash string
+	Reliability int
+}
+
+type storageQuota struct {
+	max    int64
+	used   int64
+	policy string
+	// used is reliable after all block meta loaded
+	loaded bool
+	lock   *sync.Mutex
+	// cids of evicted blocks wait to announce to scheduler
+	evicted      []string
+	evictedAlarm chan struct{}
+}
+
+// SetStorageQuota limit the total size of blocks, quota <= 0 means no limit
+func (block *Block) SetStorageQuota(quota int64, policy string) error {
+	if quota <= 0 {
+		return nil
+	}
+
+	if policy != EvictPolicyLRU && policy != EvictPolicyReliability {
+		return fmt.Errorf("unknown evict policy %s", policy)
+	}
+
+	block.quota = &storageQuota{max: quota, policy: policy, lock: &sync.Mutex{}, evictedAlarm: make(chan struct{}, 1)}
+
+	go block.loadBlockMetas()
+	go block.announceEvictedBlocks()
+
+	log.Infof("storage quota %d, evict policy %s", quota, policy)
+	return nil
+}
+
+func (block *Block) isQuotaEnable() bool {
+	return block.quota != nil
+}
+
+// load all block meta and sum the used size,
+// create meta for the blocks which were saved before quota enable
+func (block *Block) loadBlockMetas() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results, err := block.ds.Query(ctx, query.Query{Prefix: "fid"})
+	if err != nil {
+		log.Errorf("loadBlockMetas datastore query error:%s", err.Error())
+		return
+	}
+
+	used := int64(0)
+	for {
+		r, exist := results.NextSync()
+		if !exist {
+			break
+		}
+
+		hash := string(r.Value)
+		meta, err := block.getBlockMeta(hash)
+		if err == datastore.ErrNotFound {
+			meta, err = block.newBlockMeta(hash)
+		}
+
+		if err != nil {
+			log.Errorf("loadBlockMetas, block %s error:%s", hash, err.Error())
+			continue
+		}
+
+		used += int64(meta.Size)
+	}
+
+	block.quota.lock.Lock()
+	block.quota.used += used
+	block.quota.loaded = true
+	block.quota.lock.Unlock()
+
+	log.Infof("loadBlockMetas complete, storage used %d, quota %d", used, block.quota.max)
+}
+
+func (block *Block) newBlockMeta(hash string) (*blockMeta, error) {
+	reader, err := block.blockStore.GetReader(hash)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	meta := &blockMeta{Size: int(reader.Size())}
+	return meta, block.putBlockMeta(hash, meta)
+}
+
+func (block *Block) getBlockMeta(hash string) (*blockMeta, error) {
+	value, err := block.ds.Get(context.Background(), helper.NewKeyBlockMeta(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &blockMeta{}
+	err = json.Unmarshal(value, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+func (block *Block) putBlockMeta(hash string, meta *blockMeta) error {
+	value, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	return block.ds.Put(context.Background(), helper.NewKeyBlockMeta(hash), value)
+}
+
+// save meta and count the size of new block
+func (block *Block) addBlockMeta(hash string, size int) {
+	if !block.isQuotaEnable() {
+		return
+	}
+
+	meta, err := block.getBlockMeta(hash)
+	if err != nil {
+		meta = &blockMeta{}
+	}
+
+	block.quota.lock.Lock()
+	block.quota.used += int64(size - meta.Size)
+	block.quota.lock.Unlock()
+
+	meta.Size = size
+	meta.LastAccess = time.Now().Unix()
+
+	err = block.putBlockMeta(hash, meta)
+	if err != nil {
+		log.Errorf("addBlockMeta, block %s error:%s", hash, err.Error())
+	}
+}
+
+func (block *Block) setBlockMetaCarfile(hash, carfileHash string, reliability int) {
+	if !block.isQuotaEnable() {
+		return
+	}
+
+	meta, err := block.getBlockMeta(hash)
+	if err != nil {
+		log.Errorf("setBlockMetaCarfile, get block %s meta error:%s", hash, err.Error())
+		return
+	}
+
+	meta.CarfileHash = carfileHash
+	meta.Reliability = reliability
+
+	err = block.putBlockMeta(hash, meta)
+	if err != nil {
+		log.Errorf("setBlockMetaCarfile, block %s error:%s", hash, err.Error())
+	}
+}
+
+func (block *Block) deleteBlockMeta(hash string) {
+	if !block.isQuotaEnable() {
+		return
+	}
+
+	meta, err := block.getBlockMeta(hash)
+	if err != nil {
+		return
+	}
+
+	block.quota.lock.Lock()
+	block.quota.used -= int64(meta.Size)
+	block.quota.lock.Unlock()
+
+	err = block.ds.Delete(context.Background(), helper.NewKeyBlockMeta(hash))
+	if err != nil {
+		log.Errorf("deleteBlockMeta, block %s error:%s", hash, err.Error())
+	}
+}
+
+// UpdateBlockAccessTime call by download server after user download block
+func (block *Block) UpdateBlockAccessTime(hash string) {
+	if !block.isQuotaEnable() {
+		return
+	}
+
+	meta, err := block.getBlockMeta(hash)
+	if err != nil {
+		return
+	}
+
+	meta.LastAccess = time.Now().Unix()
+
+	err = block.putBlockMeta(hash, meta)
+	if err != nil {
+		log.Errorf("UpdateBlockAccessTime, block %s error:%s", hash, err.Error())
+	}
+}
+
+// evict blocks by policy if there is not enough quota for the new block
+func (block *Block) makeRoomForBlock(size int) error {
+	if !block.isQuotaEnable() {
+		return nil
+	}
+
+	block.quota.lock.Lock()
+	loaded := block.quota.loaded
+	need := block.quota.used + int64(size) - block.quota.max
+	block.quota.lock.Unlock()
+
+	if !loaded || need <= 0 {
+		return nil
+	}
+
+	if need < block.quota.max/evictBatchDivisor {
+		need = block.quota.max / evictBatchDivisor
+	}
+
+	cids, err := block.selectEvictBlocks(need)
+	if err != nil {
+		return err
+	}
+
+	if len(cids) > 0 {
+		evicted := make([]string, 0, len(cids))
+		for _, cid := range cids {
+			err = block.deleteBlock(cid)
+			if err != nil {
+				log.Errorf("makeRoomForBlock, evict block %s error:%s", cid, err.Error())
+				continue
+			}
+			evicted = append(evicted, cid)
+		}
+
+		// scheduler is told in background, saving block is not blocked by scheduler api
+		block.queueEvictedBlocks(evicted)
+
+		log.Infof("evict blocks %d, failed %d, policy %s", len(evicted), len(cids)-len(evicted), block.quota.policy)
+	}
+
+	block.quota.lock.Lock()
+	defer block.quota.lock.Unlock()
+
+	if block.quota.used+int64(size) > block.quota.max {
+		return fmt.Errorf("storage quota %d exceeded, used %d, block size %d", block.quota.max, block.quota.used, size)
+	}
+
+	return nil
+}
+
+func (block *Block) queueEvictedBlocks(cids []string) {
+	if len(cids) == 0 {
+		return
+	}
+
+	block.quota.lock.Lock()
+	block.quota.evicted = append(block.quota.evicted, cids...)
+	block.quota.lock.Unlock()
+
+	select {
+	case block.quota.evictedAlarm <- struct{}{}:
+	default:
+	}
+}
+
+// announceEvictedBlocks told scheduler the evicted blocks, the blocks failed to announce will be retried later
+func (block *Block) announceEvictedBlocks() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-block.quota.evictedAlarm:
+		case <-ticker.C:
+		}
+
+		block.announceEvicted()
+	}
+}
+
+// announceEvicted only remove the records of evicted blocks in scheduler,
+// evicted blocks are not corrupted, so the caches of them will not be restored
+func (block *Block) announceEvicted() {
+	block.quota.lock.Lock()
+	cids := block.quota.evicted
+	block.quota.evicted = nil
+	block.quota.lock.Unlock()
+
+	if len(cids) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), helper.SchedulerApiTimeout*time.Second)
+	defer cancel()
+
+	_, err := block.scheduler.DeleteBlockRecords(ctx, block.device.GetDeviceID(), cids)
+	if err != nil {
+		log.Errorf("announceEvicted, DeleteBlockRecords error:%s", err.Error())
+
+		block.quota.lock.Lock()
+		block.quota.evicted = append(cids, block.quota.evicted...)
+		block.quota.lock.Unlock()
+	}
+}
+
+// select blocks to free at least need bytes, blocks of caching carfile will not be select
+func (block *Block) selectEvictBlocks(need int64) ([]string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results, err := block.ds.Query(ctx, query.Query{Prefix: helper.KeyBlockMetaPrefix})
+	if err != nil {
+		return nil, err
+	}
+
+	cachingCarfiles := block.getCachingCarfiles()
+
+	type candidate struct {
+		hash string
+		meta blockMeta
+	}
+
+	candidates := make([]candidate, 0)
+	for {
+		r, exist := results.NextSync()
+		if !exist {
+			break
+		}
+
+		meta := blockMeta{}
+		err = json.Unmarshal(r.Value, &meta)
+		if err != nil {
+			log.Errorf("selectEvictBlocks, unmarshal block meta %s error:%s", r.Key, err.Error())
+			continue
+		}
+
+		if _, exist := cachingCarfiles[meta.CarfileHash]; exist && len(meta.CarfileHash) > 0 {
+			continue
+		}
+
+		hash := r.Key[len(helper.KeyBlockMetaPrefix)+1:]
+		candidates = append(candidates, candidate{hash: hash, meta: meta})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if block.quota.policy == EvictPolicyReliability && candidates[i].meta.Reliability != candidates[j].meta.Reliability {
+			return candidates[i].meta.Reliability < candidates[j].meta.Reliability
+		}
+		return candidates[i].meta.LastAccess < candidates[j].meta.LastAccess
+	})
+
+	freed := int64(0)
+	cids := make([]string, 0)
+	for _, c := range candidates {
+		if freed >= need {
+			break
+		}
+
+		cid, err := helper.HashString2CidString(c.hash)
+		if err != nil {
+			continue
+		}
+
+		cids = append(cids, cid)
+		freed += int64(c.meta.Size)
+	}
+
+	return cids, nil
+}
+
+func (block *Block) getCachingCarfiles() map[string]struct{} {
+	block.queueLock.Lock()
+	defer block.queueLock.Unlock()
+
+	carfiles := make(map[string]struct{})
+	for e := block.carfileList.Front(); e != nil; e = e.Next() {
+		carfile := e.Value.(*carfile)
+		carfiles[carfile.carfileHash] = struct{}{}
+	}
+
+	for _, worker := range block.loaderWorkers {
+		for _, req := range worker.reqs {
+			carfiles[req.carFileHash] = struct{}{}
+		}
+	}
+
+	return carfiles
+}
@@ -0,0 +1,170 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/blockstore"
+	"github.com/linguohua/titan/node/device"
+	"github.com/linguohua/titan/node/helper"
+)
+
+// newQuotaBlock save 4 blocks of 100 bytes with quota 400, the last access time of block i is i,
+// reliability of block i is reliabilitys[i]
+func newQuotaBlock(t *testing.T, policy string, reliabilitys []int) (*Block, []blocks.Block) {
+	ctx := context.Background()
+
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	bs := blockstore.NewBlockStore(t.TempDir(), "FileStore")
+	block := NewBlock(ds, bs, nil, NewBitswap(nil), nil, "http://127.0.0.1:5001", 0)
+	block.quota = &storageQuota{max: 400, policy: policy, loaded: true, lock: &sync.Mutex{}, evictedAlarm: make(chan struct{}, 1)}
+
+	blks := make([]blocks.Block, 0, len(reliabilitys))
+	for i, reliability := range reliabilitys {
+		b := blocks.NewBlock(bytes.Repeat([]byte{byte(i)}, 100))
+		if err := block.saveBlock(ctx, b.RawData(), b.Cid().String(), fmt.Sprintf("%d", i+1)); err != nil {
+			t.Fatal(err)
+		}
+
+		hash := b.Cid().Hash().String()
+		block.setBlockMetaCarfile(hash, fmt.Sprintf("carfile%d", i), reliability)
+
+		meta, err := block.getBlockMeta(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta.LastAccess = int64(i)
+		if err := block.putBlockMeta(hash, meta); err != nil {
+			t.Fatal(err)
+		}
+
+		blks = append(blks, b)
+	}
+
+	if block.quota.used != 400 {
+		t.Fatalf("quota used %d, expect 400", block.quota.used)
+	}
+
+	return block, blks
+}
+
+func checkEvicted(t *testing.T, block *Block, blks []blocks.Block, evicted int) {
+	for i, b := range blks {
+		exist, err := block.blockStore.Has(b.Cid().Hash().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if exist == (i == evicted) {
+			t.Fatalf("block %d exist %v, expect block %d evicted", i, exist, evicted)
+		}
+	}
+
+	if !isEvicted(block, blks[evicted]) {
+		t.Fatalf("evicted blocks %v wait to announce, expect %s", block.quota.evicted, blks[evicted].Cid().String())
+	}
+
+	if block.quota.used != 300 {
+		t.Fatalf("quota used %d, expect 300", block.quota.used)
+	}
+}
+
+// isEvicted check b is the only block wait to announce
+func isEvicted(block *Block, b blocks.Block) bool {
+	if len(block.quota.evicted) != 1 {
+		return false
+	}
+
+	hash, err := helper.CIDString2HashString(block.quota.evicted[0])
+	return err == nil && hash == b.Cid().Hash().String()
+}
+
+func TestEvictLRU(t *testing.T) {
+	block, blks := newQuotaBlock(t, EvictPolicyLRU, []int{1, 1, 1, 1})
+
+	// block 0 is downloaded recently, block 1 is the least recently used
+	block.UpdateBlockAccessTime(blks[0].Cid().Hash().String())
+
+	if err := block.makeRoomForBlock(100); err != nil {
+		t.Fatal(err)
+	}
+
+	checkEvicted(t, block, blks, 1)
+}
+
+func TestEvictReliability(t *testing.T) {
+	block, blks := newQuotaBlock(t, EvictPolicyReliability, []int{3, 2, 1, 2})
+
+	if err := block.makeRoomForBlock(100); err != nil {
+		t.Fatal(err)
+	}
+
+	checkEvicted(t, block, blks, 2)
+
+	// block of caching carfile is not evicted
+	block.carfileList.PushBack(&carfile{carfileHash: "carfile1"})
+	block.carfileList.PushBack(&carfile{carfileHash: "carfile3"})
+	block.quota.evicted = nil
+
+	if err := block.makeRoomForBlock(200); err != nil {
+		t.Fatal(err)
+	}
+
+	if !isEvicted(block, blks[0]) {
+		t.Fatalf("evicted blocks %v, expect block of carfile0", block.quota.evicted)
+	}
+}
+
+type evictScheduler struct {
+	api.SchedulerStub
+	deleted   []string
+	corrupted []string
+}
+
+func (s *evictScheduler) DeleteBlockRecords(ctx context.Context, deviceID string, cids []string) (map[string]string, error) {
+	s.deleted = append(s.deleted, cids...)
+	return nil, nil
+}
+
+func (s *evictScheduler) NodeReportCorruptedBlocks(ctx context.Context, cids []string) error {
+	s.corrupted = append(s.corrupted, cids...)
+	return nil
+}
+
+func TestAnnounceEvicted(t *testing.T) {
+	block, blks := newQuotaBlock(t, EvictPolicyLRU, []int{1, 1, 1, 1})
+	scheduler := &evictScheduler{}
+	block.scheduler = scheduler
+	block.device = device.NewDevice("device", "", "", 0, 0, block.blockStore)
+
+	if err := block.makeRoomForBlock(100); err != nil {
+		t.Fatal(err)
+	}
+
+	evicted := block.quota.evicted
+	if !isEvicted(block, blks[0]) {
+		t.Fatalf("evicted blocks %v, expect block 0", evicted)
+	}
+
+	block.announceEvicted()
+
+	// evicted block is only deleted from records, not reported as corrupted
+	if len(scheduler.deleted) != 1 || scheduler.deleted[0] != evicted[0] {
+		t.Fatalf("deleted records %v, expect %v", scheduler.deleted, evicted)
+	}
+
+	if len(scheduler.corrupted) != 0 {
+		t.Fatalf("corrupted blocks %v, expect none", scheduler.corrupted)
+	}
+
+	if len(block.quota.evicted) != 0 {
+		t.Fatalf("evicted blocks %v wait to announce, expect none", block.quota.evicted)
+	}
+}
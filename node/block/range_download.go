@@ -0,0 +1,135 @@
+package block
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/linguohua/titan/node/helper"
+)
+
+// getPartialBlockDir return the directory of partially downloaded blocks, the download is resumed from it on retry
+func (block *Block) getPartialBlockDir() (string, error) {
+	if block.partialBlockDir == "" {
+		return "", fmt.Errorf("partial block dir is not set")
+	}
+
+	err := os.MkdirAll(block.partialBlockDir, 0o755)
+	if err != nil {
+		return "", err
+	}
+
+	return block.partialBlockDir, nil
+}
+
+// loadRawBlock download raw block from candidate or peer edge over http,
+// the block is written to a temp file first, so the download can be resumed with range request after failed
+func (candidate *Candidate) loadRawBlock(ctx context.Context, block *Block, req *delayReq) (int, error) {
+	target, err := cid.Decode(req.blockInfo.Cid)
+	if err != nil {
+		return 0, err
+	}
+
+	var reqURL string
+	header := http.Header{}
+	client := http.DefaultClient
+	if req.fromEdge {
+		reqURL = edgeBlockURL(req)
+		client = edgeHTTPClient(req.certFingerprint)
+	} else {
+		// block download path of candidate rpc server
+		reqURL = fmt.Sprintf("%s%s?cid=%s", req.downloadURL, helper.DownloadSrvPath, url.QueryEscape(req.blockInfo.Cid))
+		header.Add("Authorization", "Bearer "+req.downloadToken)
+	}
+
+	dir, err := block.getPartialBlockDir()
+	if err != nil {
+		return 0, err
+	}
+
+	path := filepath.Join(dir, target.Hash().String())
+	err = downloadWithResume(ctx, client, reqURL, header, path)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(path) //nolint:errcheck
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	// hash of block is checked when save
+	return block.saveBlockReader(ctx, f, req.blockInfo.Cid, fmt.Sprintf("%d", req.blockInfo.Fid))
+}
+
+// downloadWithResume download url to path with client, if path exist, only the rest of it is requested
+func downloadWithResume(ctx context.Context, client *http.Client, reqURL string, header http.Header, path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint:errcheck
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, helper.BlockDownloadTimeout*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = header.Clone()
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		log.Infof("downloadWithResume, resume %s from %d, content range %s", reqURL, offset, resp.Header.Get("Content-Range"))
+	case http.StatusOK:
+		// server does not support range, download from start
+		if offset > 0 {
+			if err = f.Truncate(0); err != nil {
+				return err
+			}
+			if _, err = f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the temp file is not the prefix of block, download from start on next retry
+		os.Remove(path) //nolint:errcheck
+		return fmt.Errorf("download %s, range from %d not satisfiable", reqURL, offset)
+	default:
+		return fmt.Errorf("download %s, status code %d", reqURL, resp.StatusCode)
+	}
+
+	n, err := io.Copy(f, resp.Body)
+	if err != nil {
+		return fmt.Errorf("download %s, written %d bytes after offset %d, error:%s", reqURL, n, offset, err.Error())
+	}
+
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return fmt.Errorf("download %s, written %d bytes, expect %d", reqURL, n, resp.ContentLength)
+	}
+
+	return nil
+}
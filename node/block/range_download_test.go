@@ -0,0 +1,47 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDownloadWithResume(t *testing.T) {
+	data := bytes.Repeat([]byte("titan"), 1024)
+
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "block", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "block")
+
+	// part of block downloaded by a failed request
+	if err := os.WriteFile(path, data[:1000], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := downloadWithResume(context.Background(), http.DefaultClient, srv.URL, http.Header{}, path); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Fatalf("download %d bytes, expect %d bytes", len(got), len(data))
+	}
+
+	if len(ranges) != 1 || ranges[0] != "bytes=1000-" {
+		t.Fatalf("request ranges %v, expect [bytes=1000-]", ranges)
+	}
+}
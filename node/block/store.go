@@ -1,7 +1,11 @@
 package block
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
+	"os"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore/query"
@@ -52,35 +56,75 @@ func (block *Block) deleteBlock(cidStr string) error {
 		return err
 	}
 
-	fid, err := block.getFIDFromCID(cid.String())
+	fid, err := block.deleteFIDAndHash(cid)
+	if err != nil {
+		return err
+	}
+
+	err = block.blockStore.Delete(cid.Hash().String())
 	if err != nil {
-		log.Errorf("deleteBlock getFIDFromCID %s error:%s", cid.String(), err.Error())
+		log.Errorf("deleteBlock blockstore delete block %s error:%s", cid, err.Error())
 		return err
 	}
 
+	block.deleteBlockMeta(cid.Hash().String())
+	block.invalidateHotCache(cid.Hash().String())
+	block.invalidateAvailableFiles()
+
+	log.Infof("Delete block %s fid %s", cid.String(), fid)
+	return nil
+}
+
+// delete the relation of fid and cid, return fid of the cid
+func (block *Block) deleteFIDAndHash(cid cid.Cid) (string, error) {
+	fid, err := block.getFIDFromCID(cid.String())
+	if err != nil {
+		log.Errorf("deleteFIDAndHash getFIDFromCID %s error:%s", cid.String(), err.Error())
+		return "", err
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	err = block.ds.Delete(ctx, helper.NewKeyFID(fid))
 	if err != nil {
-		log.Errorf("deleteBlock datastore delete fid %s error:%s", fid, err.Error())
-		return err
+		log.Errorf("deleteFIDAndHash datastore delete fid %s error:%s", fid, err.Error())
+		return "", err
 	}
 
 	err = block.ds.Delete(ctx, helper.NewKeyHash(cid.Hash().String()))
 	if err != nil {
-		log.Errorf("deleteBlock datastore delete cid %s error:%s", cid, err.Error())
-		return err
+		log.Errorf("deleteFIDAndHash datastore delete cid %s error:%s", cid, err.Error())
+		return "", err
 	}
 
-	err = block.blockStore.Delete(cid.Hash().String())
+	return fid, nil
+}
+
+// DeleteOrphanBlock delete the block which has no fid, return false if block is saving or has fid
+func (block *Block) DeleteOrphanBlock(hash string) (bool, error) {
+	block.saveBlockLock.Lock()
+	defer block.saveBlockLock.Unlock()
+
+	if _, saving := block.savingBlocks.Load(hash); saving {
+		return false, nil
+	}
+
+	exist, err := block.ds.Has(context.Background(), helper.NewKeyHash(hash))
+	if err != nil || exist {
+		return false, err
+	}
+
+	err = block.blockStore.Delete(hash)
 	if err != nil {
-		log.Errorf("deleteBlock blockstore delete block %s error:%s", cid, err.Error())
-		return err
+		return false, err
 	}
 
-	log.Infof("Delete block %s fid %s", cid.String(), fid)
-	return nil
+	block.deleteBlockMeta(hash)
+	block.invalidateHotCache(hash)
+	block.invalidateAvailableFiles()
+
+	return true, nil
 }
 
 func (block *Block) updateCidAndFid(ctx context.Context, cid cid.Cid, fid string) error {
@@ -132,22 +176,101 @@ func (block *Block) getBlockWithFID(fid string) ([]byte, error) {
 }
 
 func (block *Block) saveBlock(ctx context.Context, data []byte, cidStr, fid string) error {
-	block.saveBlockLock.Lock()
-	defer block.saveBlockLock.Unlock()
+	_, err := block.saveBlockReader(ctx, bytes.NewReader(data), cidStr, fid)
+	return err
+}
 
+// saveBlockStream spool the stream to a temp file, so the hash and size of block are checked before it is saved
+func (block *Block) saveBlockStream(ctx context.Context, r io.Reader, cidStr, fid string) (int, error) {
+	dir, err := block.getPartialBlockDir()
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := os.CreateTemp(dir, "stream-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name()) //nolint:errcheck
+	defer f.Close()           //nolint:errcheck
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	return block.saveBlockReader(ctx, f, cidStr, fid)
+}
+
+// saveBlockReader check the hash of block and make room for it before it is written to block store,
+// block store is not touched if the hash is mismatch, return the size of block
+func (block *Block) saveBlockReader(ctx context.Context, r io.ReadSeeker, cidStr, fid string) (int, error) {
 	log.Infof("saveBlock fid:%s, cid:%s", fid, cidStr)
 
 	cid, err := cid.Decode(cidStr)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	err = block.blockStore.Put(cid.Hash().String(), data)
+	decoded, err := multihash.Decode(cid.Hash())
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	hasher, err := multihash.GetHasher(decoded.Code)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(hasher, r)
+	if err != nil {
+		return 0, err
+	}
+
+	sum, err := multihash.Encode(hasher.Sum(nil)[:decoded.Length], decoded.Code)
+	if err != nil || !bytes.Equal(sum, cid.Hash()) {
+		return 0, fmt.Errorf("block %s data does not match hash", cidStr)
+	}
+
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	hash := cid.Hash().String()
+
+	block.savingBlocks.Store(hash, struct{}{})
+	defer block.savingBlocks.Delete(hash)
+
+	// quota is reserved by block meta before the block is written
+	block.saveBlockLock.Lock()
+	existed, _ := block.blockStore.Has(hash)
+	if !existed {
+		err = block.makeRoomForBlock(int(n))
+		if err != nil {
+			block.saveBlockLock.Unlock()
+			return 0, err
+		}
+	}
+	block.addBlockMeta(hash, int(n))
+	block.saveBlockLock.Unlock()
+
+	// block store make the block visible only after all data was written,
+	// the copy existed before is never removed
+	_, err = block.blockStore.PutReader(hash, r)
+	if err != nil {
+		if !existed {
+			block.deleteBlockMeta(hash)
+		}
+		return 0, err
 	}
 
-	return block.updateCidAndFid(ctx, cid, fid)
+	return int(n), block.updateCidAndFid(ctx, cid, fid)
 }
 
 func (block *Block) deleteAllBlocks() error {
@@ -0,0 +1,50 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/linguohua/titan/blockstore"
+)
+
+func TestSaveBlockReader(t *testing.T) {
+	ctx := context.Background()
+
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	bs := blockstore.NewBlockStore(t.TempDir(), "FileStore")
+	block := NewBlock(ds, bs, nil, NewBitswap(nil), nil, "http://127.0.0.1:5001", 0)
+
+	b := blocks.NewBlock([]byte("titan block"))
+	hash := b.Cid().Hash().String()
+
+	if err := block.saveBlock(ctx, b.RawData(), b.Cid().String(), "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// corrupted data does not touch the good copy
+	if _, err := block.saveBlockReader(ctx, bytes.NewReader([]byte("bad block")), b.Cid().String(), "1"); err == nil {
+		t.Fatal("save mismatch data should fail")
+	}
+
+	data, err := bs.Get(hash)
+	if err != nil || !bytes.Equal(data, b.RawData()) {
+		t.Fatalf("good copy was changed, data %q, error %v", data, err)
+	}
+
+	// quota is checked before block is written
+	block.quota = &storageQuota{max: 16, policy: EvictPolicyLRU, loaded: true, lock: &sync.Mutex{}, evictedAlarm: make(chan struct{}, 1)}
+
+	big := blocks.NewBlock(bytes.Repeat([]byte("titan"), 10))
+	if err := block.saveBlock(ctx, big.RawData(), big.Cid().String(), "2"); err == nil {
+		t.Fatal("save block bigger than quota should fail")
+	}
+
+	if exist, _ := bs.Has(big.Cid().Hash().String()); exist {
+		t.Fatal("block exceed quota should not be written")
+	}
+}
@@ -31,11 +31,20 @@ var log = logging.Logger("candidate")
 func NewLocalCandidateNode(ctx context.Context, tcpSrvAddr string, device *device.Device, params *helper.NodeParams) api.Candidate {
 	rateLimiter := rate.NewLimiter(rate.Limit(device.GetBandwidthUp()), int(device.GetBandwidthUp()))
 
-	block := block.NewBlock(params.DS, params.BlockStore, params.Scheduler, &block.IPFS{}, device, params.IPFSAPI)
-	validate := vd.NewValidate(block, device)
-	blockDownload := download.NewBlockDownload(rateLimiter, params, device, validate)
+	var blockLoader block.BlockLoader = &block.IPFS{}
+	if params.Exchange != nil {
+		blockLoader = block.NewBitswap(params.Exchange)
+	}
 
-	datasync.SyncLocalBlockstore(params.DS, params.BlockStore, block)
+	block := block.NewBlock(params.DS, params.BlockStore, params.Scheduler, blockLoader, device, params.IPFSAPI, params.LoaderWorkers)
+	err := block.SetStorageQuota(params.StorageQuota, params.EvictPolicy)
+	if err != nil {
+		log.Panicf("NewLocalCandidateNode, SetStorageQuota error:%s", err.Error())
+	}
+	block.SetHotCache(params.HotCacheSize)
+	block.SetPartialBlockDir(params.PartialBlockDir)
+	validate := vd.NewValidate(block, device)
+	blockDownload := download.NewBlockDownload(rateLimiter, params, device, validate, block)
 
 	candidate := &Candidate{
 		Device:        device,
@@ -44,7 +53,7 @@ func NewLocalCandidateNode(ctx context.Context, tcpSrvAddr string, device *devic
 		Validate:      validate,
 		scheduler:     params.Scheduler,
 		tcpSrvAddr:    tcpSrvAddr,
-		DataSync:      datasync.NewDataSync(block, params.DS),
+		DataSync:      datasync.NewDataSync(block, params),
 	}
 
 	go candidate.startTcpServer()
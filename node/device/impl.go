@@ -90,15 +90,19 @@ func (device *Device) DeviceInfo(ctx context.Context) (api.DevicesInfo, error) {
 	info.CpuUsage = cpuPercent[0]
 	info.CPUCores, _ = cpu.Counts(false)
 
-	blockStorePath := device.blockstore.GetPath()
-	usageStat, err := disk.Usage(blockStorePath)
+	// block store may be spread across several disks, use the stat of all of them
+	fsStat, err := device.blockstore.Stat()
 	if err != nil {
-		log.Errorf("get disk usage stat error: %s", err)
+		log.Errorf("get block store stat error: %s", err)
 		return api.DevicesInfo{}, err
 	}
 
-	info.DiskUsage = usageStat.UsedPercent
-	info.DiskSpace = float64(usageStat.Total)
+	if fsStat.Capacity > 0 {
+		info.DiskUsage = float64(fsStat.Capacity-fsStat.Available) / float64(fsStat.Capacity) * 100
+	}
+	info.DiskSpace = float64(fsStat.Capacity)
+
+	blockStorePath := device.blockstore.GetPath()
 
 	absPath, err := filepath.Abs(blockStorePath)
 	if err != nil {
@@ -0,0 +1,197 @@
+package download
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	carv1 "github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/lib/limiter"
+	"github.com/linguohua/titan/node/block"
+	"github.com/linguohua/titan/node/helper"
+)
+
+// max size of manifest in request body
+const batchManifestMaxSize = 1 << 20
+
+// getBatch stream the blocks of manifest with one request, manifest is the json array of cids in body,
+// request is signed by scheduler with manifest hash instead of cid.
+// Response is CARv1 with the first cid as root by default, or multipart/mixed if it is accepted
+func (bd *BlockDownload) getBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// the request is not verified yet, failure is not reported
+	cidStrs := make([]string, 0)
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, batchManifestMaxSize)).Decode(&cidStrs)
+	if err != nil {
+		log.Errorf("getBatch, parser manifest error:%s", err.Error())
+		http.Error(w, fmt.Sprintf("Parser manifest error:%s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	manifest := helper.BatchManifestHash(cidStrs)
+	sn, sign, ok := bd.verifySign(w, r, manifest)
+	if !ok {
+		return
+	}
+
+	if len(cidStrs) == 0 || len(cidStrs) > helper.BatchDownloadMaxBlocks {
+		bd.resultFailed(w, r, sn, sign, fmt.Errorf("manifest has %d cids, must be 1 to %d", len(cidStrs), helper.BatchDownloadMaxBlocks))
+		return
+	}
+
+	cids, err := bd.checkBatchBlocks(manifest, cidStrs)
+	if err != nil {
+		bd.resultFailed(w, r, sn, sign, err)
+		return
+	}
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+
+	// bytes of blocks data, it is set before pipe closed
+	var payload int64
+	contentType := carContentType
+	if strings.Contains(r.Header.Get("Accept"), "multipart/mixed") {
+		mw := multipart.NewWriter(pw)
+		contentType = "multipart/mixed; boundary=" + mw.Boundary()
+
+		go func() {
+			var err error
+			payload, err = bd.writeBatchMultipart(mw, cids)
+			pw.CloseWithError(err)
+		}()
+	} else {
+		go func() {
+			var err error
+			payload, err = bd.writeBatchCar(pw, cids)
+			pw.CloseWithError(err)
+		}()
+	}
+
+	bd.validate.CancelValidate()
+
+	w.Header().Set("Content-Type", contentType)
+
+	now := time.Now()
+
+	n, err := io.Copy(w, limiter.NewReader(pr, bd.limiter))
+	if err != nil {
+		log.Errorf("getBatch, io.Copy error:%v", err)
+		return
+	}
+
+	costTime := time.Now().Sub(now)
+
+	var speedRate = int64(0)
+	if costTime != 0 {
+		speedRate = int64(float64(n) / float64(costTime) * float64(time.Second))
+	}
+
+	// one result for all blocks of manifest, only data of blocks are counted, not the framing of CAR or multipart,
+	// batch downloaded again with the same sn is not reported
+	if size := bd.sns.serve(sn, payload, payload); size > 0 {
+		result := api.NodeBlockDownloadResult{SN: sn, Sign: sign, DownloadSpeed: speedRate, BlockSize: int(size), Result: true}
+		go bd.downloadBlockResult(result)
+	}
+
+	log.Infof("Download batch %s costTime %d, blocks %d, size %d, speed %d", manifest, costTime, len(cids), n, speedRate)
+}
+
+// checkBatchBlocks decode cids and check all blocks exist, nothing is sent if any block is missing
+func (bd *BlockDownload) checkBatchBlocks(manifest string, cidStrs []string) ([]cid.Cid, error) {
+	cids := make([]cid.Cid, 0, len(cidStrs))
+	missing := make([]string, 0)
+
+	for _, cidStr := range cidStrs {
+		c, err := cid.Decode(cidStr)
+		if err != nil {
+			return nil, fmt.Errorf("Parser cid(%s) error:%s", cidStr, err.Error())
+		}
+
+		exist, err := bd.blockStore.Has(c.Hash().String())
+		if err != nil {
+			return nil, err
+		}
+
+		if !exist {
+			missing = append(missing, cidStr)
+			continue
+		}
+
+		cids = append(cids, c)
+	}
+
+	if len(missing) > 0 {
+		return nil, &block.MissingBlocksError{CarfileCid: manifest, Cids: missing}
+	}
+
+	return cids, nil
+}
+
+// writeBatchCar write blocks as CARv1, return the bytes of blocks data
+func (bd *BlockDownload) writeBatchCar(w io.Writer, cids []cid.Cid) (int64, error) {
+	err := carv1.WriteHeader(&carv1.CarHeader{Roots: []cid.Cid{cids[0]}, Version: 1}, w)
+	if err != nil {
+		return 0, err
+	}
+
+	payload := int64(0)
+	for _, c := range cids {
+		data, err := bd.blockStore.Get(c.Hash().String())
+		if err != nil {
+			return payload, fmt.Errorf("get block %s error:%s", c.String(), err.Error())
+		}
+
+		err = carutil.LdWrite(w, c.Bytes(), data)
+		if err != nil {
+			return payload, err
+		}
+		payload += int64(len(data))
+
+		bd.block.UpdateBlockAccessTime(c.Hash().String())
+	}
+
+	return payload, nil
+}
+
+// writeBatchMultipart write every block as a part, the cid of block is the filename of part, return the bytes of blocks data
+func (bd *BlockDownload) writeBatchMultipart(mw *multipart.Writer, cids []cid.Cid) (int64, error) {
+	payload := int64(0)
+	for _, c := range cids {
+		data, err := bd.blockStore.Get(c.Hash().String())
+		if err != nil {
+			return payload, fmt.Errorf("get block %s error:%s", c.String(), err.Error())
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", rawContentType)
+		header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", c.String()))
+
+		part, err := mw.CreatePart(header)
+		if err != nil {
+			return payload, err
+		}
+
+		_, err = part.Write(data)
+		if err != nil {
+			return payload, err
+		}
+		payload += int64(len(data))
+
+		bd.block.UpdateBlockAccessTime(c.Hash().String())
+	}
+
+	return payload, mw.Close()
+}
@@ -0,0 +1,105 @@
+package download
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	car "github.com/ipld/go-car/v2"
+	"github.com/linguohua/titan/blockstore"
+	"github.com/linguohua/titan/node/block"
+)
+
+func TestBatchDownload(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	bs := blockstore.NewBlockStore(t.TempDir(), "FileStore")
+	bd := &BlockDownload{blockStore: bs, block: block.NewBlock(ds, bs, nil, block.NewBitswap(nil), nil, "", 0)}
+
+	cidStrs := make([]string, 0)
+	blks := make([]blocks.Block, 0)
+	payload := int64(0)
+	for _, data := range []string{"titan", "batch", "download"} {
+		payload += int64(len(data))
+		b := blocks.NewBlock([]byte(data))
+		if err := bs.Put(b.Cid().Hash().String(), b.RawData()); err != nil {
+			t.Fatal(err)
+		}
+		cidStrs = append(cidStrs, b.Cid().String())
+		blks = append(blks, b)
+	}
+
+	missing := blocks.NewBlock([]byte("missing"))
+	var missingErr *block.MissingBlocksError
+	if _, err := bd.checkBatchBlocks("manifest", append(cidStrs, missing.Cid().String())); !errors.As(err, &missingErr) || len(missingErr.Cids) != 1 {
+		t.Fatalf("check batch error %v, expect one missing block", err)
+	}
+
+	cids, err := bd.checkBatchBlocks("manifest", cidStrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	// only data of blocks are counted, not the framing of CAR
+	if n, err := bd.writeBatchCar(&buf, cids); err != nil || n != payload {
+		t.Fatalf("write car %d bytes of blocks, error %v, expect %d", n, err, payload)
+	}
+
+	reader, err := car.NewBlockReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, b := range blks {
+		got, err := reader.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !got.Cid().Equals(b.Cid()) || !bytes.Equal(got.RawData(), b.RawData()) {
+			t.Fatalf("car block %s, expect %s", got.Cid().String(), b.Cid().String())
+		}
+	}
+
+	buf.Reset()
+	mw := multipart.NewWriter(&buf)
+	if n, err := bd.writeBatchMultipart(mw, cids); err != nil || n != payload {
+		t.Fatalf("write multipart %d bytes of blocks, error %v, expect %d", n, err, payload)
+	}
+
+	mr := multipart.NewReader(&buf, mw.Boundary())
+	for _, b := range blks {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if part.FileName() != b.Cid().String() || !bytes.Equal(data, b.RawData()) {
+			t.Fatalf("part %s, expect block %s", part.FileName(), b.Cid().String())
+		}
+	}
+}
+
+func TestBatchDownloadBadManifest(t *testing.T) {
+	bd := &BlockDownload{}
+
+	// request is not signed, it is rejected without reporting to scheduler
+	w := httptest.NewRecorder()
+	bd.getBatch(w, httptest.NewRequest(http.MethodPost, "/block/batch", strings.NewReader("not json")))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status code %d with bad manifest, expect %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -1,24 +1,30 @@
 package download
 
 import (
+	"bufio"
 	"context"
 	"crypto/rsa"
+	"crypto/tls"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	titanRsa "github.com/linguohua/titan/node/rsa"
 
+	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/linguohua/titan/api"
 	"github.com/linguohua/titan/blockstore"
 	"github.com/linguohua/titan/lib/limiter"
+	"github.com/linguohua/titan/node/block"
 	"github.com/linguohua/titan/node/device"
 	"github.com/linguohua/titan/node/helper"
 	"github.com/linguohua/titan/node/validate"
@@ -27,24 +33,51 @@ import (
 
 var log = logging.Logger("download")
 
+var (
+	errSignExpired = errors.New(api.DownloadFailedSignExpired)
+	errSnReplayed  = errors.New(api.DownloadFailedSnReplayed)
+)
+
 type BlockDownload struct {
 	limiter    *rate.Limiter
 	blockStore blockstore.BlockStore
+	block      *block.Block
 	publicKey  *rsa.PublicKey
 	scheduler  api.Scheduler
 	device     *device.Device
 	validate   *validate.Validate
 	srvAddr    string
+	// used sn of download request
+	sns *snCache
+	// nil means serve http
+	tlsConfig *tls.Config
+	// fingerprint of self-signed certificate, client pin it
+	certFingerprint string
 }
 
-func NewBlockDownload(limiter *rate.Limiter, params *helper.NodeParams, device *device.Device, validate *validate.Validate) *BlockDownload {
+func NewBlockDownload(limiter *rate.Limiter, params *helper.NodeParams, device *device.Device, validate *validate.Validate, block *block.Block) *BlockDownload {
 	var blockDownload = &BlockDownload{
 		limiter:    limiter,
 		blockStore: params.BlockStore,
+		block:      block,
 		scheduler:  params.Scheduler,
 		srvAddr:    params.DownloadSrvAddr,
 		validate:   validate,
-		device:     device}
+		device:     device,
+		sns:        newSnCache(helper.DownloadSnCacheSize)}
+
+	if hotCache := block.HotCache(); hotCache != nil {
+		blockDownload.blockStore = hotCache
+	}
+
+	if params.DownloadSrvCertFile != "" {
+		tlsConfig, fingerprint, err := loadTLSConfig(params.DownloadSrvCertFile, params.DownloadSrvKeyFile)
+		if err != nil {
+			log.Fatalf("load download server certificate error:%s", err.Error())
+		}
+		blockDownload.tlsConfig = tlsConfig
+		blockDownload.certFingerprint = fingerprint
+	}
 
 	go blockDownload.startDownloadServer()
 
@@ -59,24 +92,38 @@ func (bd *BlockDownload) resultFailed(w http.ResponseWriter, r *http.Request, sn
 		go bd.downloadBlockResult(result)
 	}
 
-	if err == datastore.ErrNotFound {
+	if err == datastore.ErrNotFound || errors.Is(err, os.ErrNotExist) {
 		http.NotFound(w, r)
 		return
 	}
 
+	if errors.Is(err, errSignExpired) || errors.Is(err, errSnReplayed) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// the content is partially available in this node, tell client the number of missing blocks
+	var missingErr *block.MissingBlocksError
+	if errors.As(err, &missingErr) {
+		w.Header().Set("Missing-Blocks", strconv.Itoa(len(missingErr.Cids)))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
 	http.Error(w, err.Error(), http.StatusBadRequest)
 }
 
-func (bd *BlockDownload) getBlock(w http.ResponseWriter, r *http.Request) {
+// verifySign verify the sign of request which was signed by scheduler,
+// return the sn and sign of request, ok is false if request was failed
+func (bd *BlockDownload) verifySign(w http.ResponseWriter, r *http.Request, cidStr string) (sn int64, sign []byte, ok bool) {
 	appName := r.Header.Get("App-Name")
 	// sign := r.Header.Get("Sign")
-	cidStr := r.URL.Query().Get("cid")
 	signStr := r.URL.Query().Get("sign")
 	snStr := r.URL.Query().Get("sn")
 	signTime := r.URL.Query().Get("signTime")
 	timeout := r.URL.Query().Get("timeout")
 
-	log.Infof("GetBlock, App-Name:%s, sign:%s, sn:%s, signTime:%s, timeout:%s,  cid:%s", appName, signStr, snStr, signTime, timeout, cidStr)
+	log.Infof("%s, App-Name:%s, sign:%s, sn:%s, signTime:%s, timeout:%s,  cid:%s", r.URL.Path, appName, signStr, snStr, signTime, timeout, cidStr)
 
 	sn, err := strconv.ParseInt(snStr, 10, 64)
 	if err != nil {
@@ -84,20 +131,48 @@ func (bd *BlockDownload) getBlock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sign, err := hex.DecodeString(signStr)
+	sign, err = hex.DecodeString(signStr)
 	if err != nil {
 		bd.resultFailed(w, r, 0, nil, fmt.Errorf("DecodeString sign(%s) error:%s", signStr, err.Error()))
 		return
 	}
+	// failure is not reported until the sign is verified, the request may not be signed by scheduler
 	if bd.publicKey == nil {
-		bd.resultFailed(w, r, sn, sign, fmt.Errorf("node %s publicKey == nil", bd.device.GetDeviceID()))
+		bd.resultFailed(w, r, sn, nil, fmt.Errorf("node %s publicKey == nil", bd.device.GetDeviceID()))
 		return
 	}
 
 	content := cidStr + snStr + signTime + timeout
 	err = titanRsa.VerifyRsaSign(bd.publicKey, sign, content)
 	if err != nil {
-		bd.resultFailed(w, r, sn, sign, fmt.Errorf("Verify sign cid:%s,sn:%s,signTime:%s, timeout:%s, error:%s,", cidStr, snStr, signTime, timeout, err.Error()))
+		bd.resultFailed(w, r, sn, nil, fmt.Errorf("Verify sign cid:%s,sn:%s,signTime:%s, timeout:%s, error:%s,", cidStr, snStr, signTime, timeout, err.Error()))
+		return
+	}
+
+	expiredAt, err := signExpiredAt(signTime, timeout)
+	if err != nil {
+		bd.resultFailed(w, r, sn, sign, err)
+		return
+	}
+
+	if time.Now().Unix() > expiredAt+helper.DownloadSignClockSkew {
+		bd.resultFailed(w, r, sn, sign, fmt.Errorf("%w, sn:%d, expired at %s", errSignExpired, sn, time.Unix(expiredAt, 0).String()))
+		return
+	}
+
+	// sn is remembered until the sign expired, it can only be used again by range requests of the same url
+	if !bd.sns.use(sn, expiredAt+helper.DownloadSignClockSkew, r.URL.RequestURI(), r.Header.Get("Range") != "") {
+		bd.resultFailed(w, r, sn, sign, fmt.Errorf("%w, sn:%d", errSnReplayed, sn))
+		return
+	}
+
+	return sn, sign, true
+}
+
+func (bd *BlockDownload) getBlock(w http.ResponseWriter, r *http.Request) {
+	cidStr := r.URL.Query().Get("cid")
+	sn, sign, ok := bd.verifySign(w, r, cidStr)
+	if !ok {
 		return
 	}
 
@@ -118,15 +193,16 @@ func (bd *BlockDownload) getBlock(w http.ResponseWriter, r *http.Request) {
 
 	contentDisposition := fmt.Sprintf("attachment; filename=%s", cidStr)
 	w.Header().Set("Content-Disposition", contentDisposition)
-	w.Header().Set("Content-Length", strconv.FormatInt(reader.Size(), 10))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	// block is immutable, cid is strong etag of it
+	w.Header().Set("Etag", fmt.Sprintf("\"%s\"", cidStr))
 
+	cw := &countWriter{ResponseWriter: w}
 	now := time.Now()
 
-	n, err := io.Copy(w, limiter.NewReader(reader, bd.limiter))
-	if err != nil {
-		log.Errorf("GetBlock, io.Copy error:%v", err)
-		return
-	}
+	// support Range and If-None-Match, only the bytes sent are counted
+	http.ServeContent(cw, r, cidStr, time.Time{}, limiter.NewReadSeeker(reader, bd.limiter))
+	n := cw.n
 
 	costTime := time.Now().Sub(now)
 
@@ -135,14 +211,98 @@ func (bd *BlockDownload) getBlock(w http.ResponseWriter, r *http.Request) {
 		speedRate = int64(float64(n) / float64(costTime) * float64(time.Second))
 	}
 
-	result := api.NodeBlockDownloadResult{SN: sn, Sign: sign, DownloadSpeed: speedRate, BlockSize: int(n), Result: true}
-	go bd.downloadBlockResult(result)
+	bd.block.UpdateBlockAccessTime(blockHash)
+
+	// bytes sent again with the same sn are not reported
+	size := bd.sns.serve(sn, n, reader.Size())
+	if size > 0 {
+		result := api.NodeBlockDownloadResult{SN: sn, Sign: sign, DownloadSpeed: speedRate, BlockSize: int(size), Result: true}
+		go bd.downloadBlockResult(result)
+	}
 
 	log.Infof("Download block %s costTime %d, size %d, speed %d", cidStr, costTime, n, speedRate)
 
 	return
 }
 
+// getCarfile stream the DAG of carfile as CARv1, request is signed by scheduler with the carfile sign content of cid
+func (bd *BlockDownload) getCarfile(w http.ResponseWriter, r *http.Request) {
+	cidStr := r.URL.Query().Get("cid")
+	sn, sign, ok := bd.verifySign(w, r, helper.CarfileSignContent(cidStr))
+	if !ok {
+		return
+	}
+
+	root, err := cid.Decode(cidStr)
+	if err != nil {
+		bd.resultFailed(w, r, sn, sign, fmt.Errorf("Parser param cid(%s) error:%s", cidStr, err.Error()))
+		return
+	}
+
+	bd.serveCarfile(w, r, sn, sign, []cid.Cid{root})
+}
+
+// serveCarfile stream the blocks on path and DAG of the last one in path as CARv1
+func (bd *BlockDownload) serveCarfile(w http.ResponseWriter, r *http.Request, sn int64, sign []byte, pathCids []cid.Cid) {
+	target := pathCids[len(pathCids)-1]
+	cidStr := target.String()
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+
+	// payload of blocks written to pipe
+	payloadCh := make(chan int64, 1)
+	go func() {
+		result, err := bd.block.WritePathCarfile(r.Context(), pathCids, pw)
+		pw.CloseWithError(err)
+		payloadCh <- result.TotalSize
+	}()
+
+	// nothing is written if DAG is not complete, the error with missing cids is return to client
+	reader := bufio.NewReader(pr)
+	_, err := reader.Peek(1)
+	if err != nil {
+		bd.resultFailed(w, r, sn, sign, err)
+		return
+	}
+
+	bd.validate.CancelValidate()
+
+	contentDisposition := fmt.Sprintf("attachment; filename=%s.car", cidStr)
+	w.Header().Set("Content-Disposition", contentDisposition)
+	w.Header().Set("Content-Type", "application/vnd.ipld.car")
+
+	now := time.Now()
+
+	n, err := io.Copy(w, limiter.NewReader(reader, bd.limiter))
+	if err != nil {
+		log.Errorf("serveCarfile, io.Copy error:%v", err)
+	}
+
+	// stop writing if client gone, only the blocks written before are reported,
+	// blocks still buffered in reader are not sent
+	pr.Close()
+	payload := <-payloadCh
+	if payload > n {
+		payload = n
+	}
+
+	costTime := time.Now().Sub(now)
+
+	var speedRate = int64(0)
+	if costTime != 0 {
+		speedRate = int64(float64(n) / float64(costTime) * float64(time.Second))
+	}
+
+	// carfile downloaded again with the same sn is not reported
+	if size := bd.sns.serve(sn, payload, payload); size > 0 {
+		result := api.NodeBlockDownloadResult{SN: sn, Sign: sign, DownloadSpeed: speedRate, BlockSize: int(size), Result: true}
+		go bd.downloadBlockResult(result)
+	}
+
+	log.Infof("Download carfile %s costTime %d, size %d, speed %d", cidStr, costTime, n, speedRate)
+}
+
 func getClientIP(r *http.Request) string {
 	reqIP := r.Header.Get("X-Real-IP")
 	if reqIP == "" {
@@ -169,6 +329,10 @@ func (bd *BlockDownload) downloadBlockResult(result api.NodeBlockDownloadResult)
 func (bd *BlockDownload) startDownloadServer() {
 	mux := http.NewServeMux()
 	mux.HandleFunc(helper.DownloadSrvPath, bd.getBlock)
+	mux.HandleFunc(helper.DownloadCarfileSrvPath, bd.getCarfile)
+	mux.HandleFunc(helper.DownloadCacheSrvPath, bd.getCacheBlock)
+	mux.HandleFunc(helper.DownloadGatewaySrvPath, bd.getGateway)
+	mux.HandleFunc(helper.DownloadBatchSrvPath, bd.getBatch)
 
 	srv := &http.Server{
 		Handler: mux,
@@ -180,6 +344,10 @@ func (bd *BlockDownload) startDownloadServer() {
 		log.Fatal(err)
 	}
 
+	if bd.tlsConfig != nil {
+		nl = tls.NewListener(nl, bd.tlsConfig)
+	}
+
 	log.Infof("download server listen on %s", bd.srvAddr)
 
 	err = srv.Serve(nl)
@@ -218,11 +386,22 @@ func (bd *BlockDownload) GetRateLimit() int64 {
 }
 
 func (bd *BlockDownload) GetDownloadSrvURL() string {
+	scheme := "http"
+	if bd.tlsConfig != nil {
+		scheme = "https"
+	}
+
 	addrSplit := strings.Split(bd.srvAddr, ":")
-	url := fmt.Sprintf("http://%s:%s%s", bd.device.GetExternaIP(), addrSplit[1], helper.DownloadSrvPath)
+	url := fmt.Sprintf("%s://%s:%s%s", scheme, bd.device.GetExternaIP(), addrSplit[1], helper.DownloadSrvPath)
 	return url
 }
 
+// GetDownloadSrvCertFingerprint return fingerprint of self-signed certificate of download server,
+// empty if download server is http or certificate is not self-signed
+func (bd *BlockDownload) GetDownloadSrvCertFingerprint() string {
+	return bd.certFingerprint
+}
+
 func (bd *BlockDownload) LoadPublicKey() error {
 	ctx, cancel := context.WithTimeout(context.Background(), helper.SchedulerApiTimeout*time.Second)
 	defer cancel()
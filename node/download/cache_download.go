@@ -0,0 +1,118 @@
+package download
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/lib/limiter"
+	"github.com/linguohua/titan/node/helper"
+	titanRsa "github.com/linguohua/titan/node/rsa"
+)
+
+// getCacheBlock serve the block to a peer edge which is caching carfile,
+// every block is signed by scheduler with the key of this node and expired after timeout,
+// download result is not reported to scheduler
+func (bd *BlockDownload) getCacheBlock(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	cidStr := query.Get("cid")
+	carfileHash := query.Get("carfile")
+	signTime := query.Get("signTime")
+	timeout := query.Get("timeout")
+
+	log.Infof("getCacheBlock, cid:%s, carfile:%s, signTime:%s, timeout:%s", cidStr, carfileHash, signTime, timeout)
+
+	err := bd.verifyCacheSign(carfileHash, cidStr, signTime, timeout, query.Get("sign"))
+	if err != nil {
+		log.Errorf("getCacheBlock, verify sign error:%s", err.Error())
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	bd.serveBlockRange(w, r, cidStr)
+}
+
+// ServeBlock serve the block to node which load block from candidate, the request must carry the rpc token from scheduler,
+// auth handler pass the request without token, so the permission is checked here
+func (bd *BlockDownload) ServeBlock(w http.ResponseWriter, r *http.Request) {
+	cidStr := r.URL.Query().Get("cid")
+	log.Infof("ServeBlock, cid:%s, range:%s", cidStr, r.Header.Get("Range"))
+
+	if !auth.HasPerm(r.Context(), nil, api.PermRead) {
+		log.Errorf("ServeBlock, cid:%s, request without permission", cidStr)
+		http.Error(w, "permission denied", http.StatusUnauthorized)
+		return
+	}
+
+	bd.serveBlockRange(w, r, cidStr)
+}
+
+// serveBlockRange serve block with range request, so the node can resume the download of large block
+func (bd *BlockDownload) serveBlockRange(w http.ResponseWriter, r *http.Request, cidStr string) {
+	blockHash, err := helper.CIDString2HashString(cidStr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Parser param cid(%s) error:%s", cidStr, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	reader, err := bd.blockStore.GetReader(blockHash)
+	if err != nil {
+		log.Errorf("serveBlockRange, get block %s error:%s", cidStr, err.Error())
+		http.NotFound(w, r)
+		return
+	}
+	defer reader.Close()
+
+	// set content type, so ServeContent does not sniff the content
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, cidStr, time.Time{}, limiter.NewReadSeeker(reader, bd.limiter))
+
+	bd.block.UpdateBlockAccessTime(blockHash)
+}
+
+// verifyCacheSign verify the sign of block, the content signed is carfile hash, block hash, signTime and timeout
+func (bd *BlockDownload) verifyCacheSign(carfileHash, cidStr, signTime, timeout, signStr string) error {
+	if bd.publicKey == nil {
+		return fmt.Errorf("node %s publicKey == nil", bd.device.GetDeviceID())
+	}
+
+	blockHash, err := helper.CIDString2HashString(cidStr)
+	if err != nil {
+		return fmt.Errorf("Parser param cid(%s) error:%s", cidStr, err.Error())
+	}
+
+	expiredAt, err := signExpiredAt(signTime, timeout)
+	if err != nil {
+		return err
+	}
+
+	if time.Now().Unix() > expiredAt+helper.DownloadSignClockSkew {
+		return fmt.Errorf("%w, expired at %s", errSignExpired, time.Unix(expiredAt, 0).String())
+	}
+
+	sign, err := hex.DecodeString(signStr)
+	if err != nil {
+		return fmt.Errorf("DecodeString sign(%s) error:%s", signStr, err.Error())
+	}
+
+	return titanRsa.VerifyRsaSign(bd.publicKey, sign, carfileHash+blockHash+signTime+timeout)
+}
+
+// signExpiredAt return the unix time of sign expired, signTime and timeout are seconds
+func signExpiredAt(signTime, timeout string) (int64, error) {
+	st, err := strconv.ParseInt(signTime, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Parser param signTime(%s) error:%s", signTime, err.Error())
+	}
+
+	t, err := strconv.ParseInt(timeout, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Parser param timeout(%s) error:%s", timeout, err.Error())
+	}
+
+	return st + t, nil
+}
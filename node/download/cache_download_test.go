@@ -0,0 +1,120 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipfs/go-merkledag"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/blockstore"
+	"github.com/linguohua/titan/node/block"
+	"github.com/linguohua/titan/node/device"
+	titanRsa "github.com/linguohua/titan/node/rsa"
+	"golang.org/x/time/rate"
+)
+
+// newCacheBlockDownload return download server of a node, which verify sign with the public key of privateKey
+func newCacheBlockDownload(t *testing.T, privateKey *rsa.PrivateKey) (*BlockDownload, blockstore.BlockStore) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	bs := blockstore.NewBlockStore(t.TempDir(), "FileStore")
+	bd := &BlockDownload{
+		limiter:    rate.NewLimiter(rate.Inf, 0),
+		blockStore: bs,
+		block:      block.NewBlock(ds, bs, nil, block.NewBitswap(nil), nil, "", 0),
+		publicKey:  &privateKey.PublicKey,
+		device:     device.NewDevice("device", "", "", 0, 0, bs),
+	}
+
+	return bd, bs
+}
+
+func TestServeBlock(t *testing.T) {
+	privateKey, err := titanRsa.GeneratePrivateKey(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bd, bs := newCacheBlockDownload(t, privateKey)
+	b := merkledag.NewRawNode([]byte("titan candidate block"))
+	if err := bs.Put(b.Cid().Hash().String(), b.RawData()); err != nil {
+		t.Fatal(err)
+	}
+
+	// auth handler pass the request without token, and without permission in context
+	w := httptest.NewRecorder()
+	bd.ServeBlock(w, httptest.NewRequest(http.MethodGet, "/block/get?cid="+b.Cid().String(), nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status code %d without token, expect %d", w.Code, http.StatusUnauthorized)
+	}
+
+	ctx := auth.WithPerm(context.Background(), []auth.Permission{api.PermRead})
+	w = httptest.NewRecorder()
+	bd.ServeBlock(w, httptest.NewRequest(http.MethodGet, "/block/get?cid="+b.Cid().String(), nil).WithContext(ctx))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), b.RawData()) {
+		t.Fatalf("status code %d, body %q, expect block data", w.Code, w.Body.String())
+	}
+}
+
+func TestGetCacheBlock(t *testing.T) {
+	privateKey, err := titanRsa.GeneratePrivateKey(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bd, bs := newCacheBlockDownload(t, privateKey)
+
+	b := merkledag.NewRawNode([]byte("titan cache block"))
+	other := merkledag.NewRawNode([]byte("titan other block"))
+	for _, blk := range []*merkledag.RawNode{b, other} {
+		if err := bs.Put(blk.Cid().Hash().String(), blk.RawData()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// request block cidStr with the sign of signHash
+	request := func(cidStr, signHash string, signTime int64) *httptest.ResponseRecorder {
+		content := fmt.Sprintf("carfile%s%d%d", signHash, signTime, 60)
+		sign, err := titanRsa.RsaSign(privateKey, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		query := url.Values{}
+		query.Set("cid", cidStr)
+		query.Set("carfile", "carfile")
+		query.Set("signTime", fmt.Sprintf("%d", signTime))
+		query.Set("timeout", "60")
+		query.Set("sign", hex.EncodeToString(sign))
+
+		w := httptest.NewRecorder()
+		bd.getCacheBlock(w, httptest.NewRequest(http.MethodGet, "/block/cache?"+query.Encode(), nil))
+		return w
+	}
+
+	now := time.Now().Unix()
+	w := request(b.Cid().String(), b.Cid().Hash().String(), now)
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), b.RawData()) {
+		t.Fatalf("status code %d, body %q, expect block data", w.Code, w.Body.String())
+	}
+
+	// sign of a block can not download other block
+	if w := request(other.Cid().String(), b.Cid().Hash().String(), now); w.Code != http.StatusForbidden {
+		t.Fatalf("status code %d with sign of other block, expect %d", w.Code, http.StatusForbidden)
+	}
+
+	expired := now - 3600
+	if w := request(b.Cid().String(), b.Cid().Hash().String(), expired); w.Code != http.StatusForbidden {
+		t.Fatalf("status code %d with expired sign, expect %d", w.Code, http.StatusForbidden)
+	}
+}
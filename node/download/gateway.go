@@ -0,0 +1,145 @@
+package download
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/lib/limiter"
+	"github.com/linguohua/titan/node/helper"
+)
+
+const (
+	carContentType = "application/vnd.ipld.car"
+	rawContentType = "application/vnd.ipld.raw"
+)
+
+// getGateway serve /ipfs/<root>/<path> as trustless gateway, the request is signed by scheduler with the gateway sign content of root.
+// Response is the file of path by default, CAR of path with format=car and the block of path with format=raw,
+// or the Accept header with content type of CAR or raw block
+func (bd *BlockDownload) getGateway(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, helper.DownloadGatewaySrvPath), "/")
+	rootStr := segments[0]
+
+	sn, sign, ok := bd.verifySign(w, r, helper.GatewaySignContent(rootStr))
+	if !ok {
+		return
+	}
+
+	root, err := cid.Decode(rootStr)
+	if err != nil {
+		bd.resultFailed(w, r, sn, sign, fmt.Errorf("Parser root cid(%s) error:%s", rootStr, err.Error()))
+		return
+	}
+
+	pathCids, err := bd.block.ResolvePath(r.Context(), root, segments[1:])
+	if err != nil {
+		bd.resultFailed(w, r, sn, sign, err)
+		return
+	}
+
+	w.Header().Set("X-Ipfs-Path", r.URL.Path)
+
+	switch gatewayResponseFormat(r) {
+	case carContentType:
+		bd.serveCarfile(w, r, sn, sign, pathCids)
+	case rawContentType:
+		bd.serveGatewayBlock(w, r, sn, sign, pathCids[len(pathCids)-1])
+	default:
+		bd.serveGatewayFile(w, r, sn, sign, pathCids[len(pathCids)-1], segments[len(segments)-1])
+	}
+}
+
+func gatewayResponseFormat(r *http.Request) string {
+	switch r.URL.Query().Get("format") {
+	case "car":
+		return carContentType
+	case "raw":
+		return rawContentType
+	}
+
+	accept := r.Header.Get("Accept")
+	if strings.Contains(accept, carContentType) {
+		return carContentType
+	}
+
+	if strings.Contains(accept, rawContentType) {
+		return rawContentType
+	}
+
+	return ""
+}
+
+// serveGatewayFile reassemble the UnixFS file and serve it with range request
+func (bd *BlockDownload) serveGatewayFile(w http.ResponseWriter, r *http.Request, sn int64, sign []byte, target cid.Cid, name string) {
+	reader, err := bd.block.OpenFile(r.Context(), target)
+	if err != nil {
+		bd.resultFailed(w, r, sn, sign, err)
+		return
+	}
+	defer reader.Close()
+
+	bd.validate.CancelValidate()
+
+	w.Header().Set("Etag", fmt.Sprintf("\"%s\"", target.String()))
+
+	cw := &countWriter{ResponseWriter: w}
+	now := time.Now()
+
+	// content type is detected by extension of name or content
+	http.ServeContent(cw, r, name, time.Time{}, limiter.NewReadSeeker(reader, bd.limiter))
+
+	bd.gatewayResult(sn, sign, target, cw.n, int64(reader.Size()), time.Since(now))
+}
+
+func (bd *BlockDownload) serveGatewayBlock(w http.ResponseWriter, r *http.Request, sn int64, sign []byte, target cid.Cid) {
+	reader, err := bd.blockStore.GetReader(target.Hash().String())
+	if err != nil {
+		bd.resultFailed(w, r, sn, sign, err)
+		return
+	}
+	defer reader.Close()
+
+	bd.validate.CancelValidate()
+
+	w.Header().Set("Content-Type", rawContentType)
+	w.Header().Set("Etag", fmt.Sprintf("\"%s.raw\"", target.String()))
+
+	cw := &countWriter{ResponseWriter: w}
+	now := time.Now()
+
+	http.ServeContent(cw, r, target.String(), time.Time{}, limiter.NewReadSeeker(reader, bd.limiter))
+
+	bd.block.UpdateBlockAccessTime(target.Hash().String())
+	bd.gatewayResult(sn, sign, target, cw.n, reader.Size(), time.Since(now))
+}
+
+// gatewayResult report n bytes sent of content with size, bytes sent again with the same sn are not reported
+func (bd *BlockDownload) gatewayResult(sn int64, sign []byte, target cid.Cid, n int64, size int64, costTime time.Duration) {
+	var speedRate = int64(0)
+	if costTime != 0 {
+		speedRate = int64(float64(n) / float64(costTime) * float64(time.Second))
+	}
+
+	if reported := bd.sns.serve(sn, n, size); reported > 0 {
+		result := api.NodeBlockDownloadResult{SN: sn, Sign: sign, DownloadSpeed: speedRate, BlockSize: int(reported), Result: true}
+		go bd.downloadBlockResult(result)
+	}
+
+	log.Infof("Gateway download %s costTime %d, size %d, speed %d", target.String(), costTime, n, speedRate)
+}
+
+// countWriter count the bytes of response body
+type countWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.ResponseWriter.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
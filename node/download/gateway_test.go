@@ -0,0 +1,87 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-merkledag"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/helper"
+	titanRsa "github.com/linguohua/titan/node/rsa"
+	"github.com/linguohua/titan/node/validate"
+)
+
+type resultScheduler struct {
+	api.SchedulerStub
+	results chan api.NodeBlockDownloadResult
+}
+
+func (s *resultScheduler) NodeResultForUserDownloadBlock(ctx context.Context, result api.NodeBlockDownloadResult) error {
+	s.results <- result
+	return nil
+}
+
+func TestGatewaySign(t *testing.T) {
+	privateKey, err := titanRsa.GeneratePrivateKey(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bd, bs := newCacheBlockDownload(t, privateKey)
+	scheduler := &resultScheduler{results: make(chan api.NodeBlockDownloadResult, 1)}
+	bd.scheduler = scheduler
+	bd.validate = &validate.Validate{}
+	bd.sns = newSnCache(helper.DownloadSnCacheSize)
+
+	b := merkledag.NewRawNode([]byte("titan gateway block"))
+	if err := bs.Put(b.Cid().Hash().String(), b.RawData()); err != nil {
+		t.Fatal(err)
+	}
+
+	// request the raw block of root with the sign of content
+	request := func(sn int64, content string) *httptest.ResponseRecorder {
+		signTime := time.Now().Unix()
+		sign, err := titanRsa.RsaSign(privateKey, fmt.Sprintf("%s%d%d%d", content, sn, signTime, 60))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		query := url.Values{}
+		query.Set("sn", fmt.Sprintf("%d", sn))
+		query.Set("signTime", fmt.Sprintf("%d", signTime))
+		query.Set("timeout", "60")
+		query.Set("sign", hex.EncodeToString(sign))
+		query.Set("format", "raw")
+
+		w := httptest.NewRecorder()
+		bd.getGateway(w, httptest.NewRequest(http.MethodGet, helper.DownloadGatewaySrvPath+b.Cid().String()+"?"+query.Encode(), nil))
+		return w
+	}
+
+	// sign of block can not download with gateway
+	if w := request(1, b.Cid().String()); w.Code == http.StatusOK {
+		t.Fatal("gateway download with sign of block should fail")
+	}
+
+	w := request(2, helper.GatewaySignContent(b.Cid().String()))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), b.RawData()) {
+		t.Fatalf("status code %d, body %q, expect block data", w.Code, w.Body.String())
+	}
+
+	// bytes sent are reported
+	select {
+	case result := <-scheduler.results:
+		if result.SN != 2 || result.BlockSize != len(b.RawData()) {
+			t.Fatalf("report sn %d, %d bytes, expect sn 2, %d bytes", result.SN, result.BlockSize, len(b.RawData()))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("gateway download was not reported")
+	}
+}
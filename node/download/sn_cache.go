@@ -0,0 +1,96 @@
+package download
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// snCache remember the sn of download request until the sign expired, so the request can not be replayed.
+// The sn can be used again only by range requests continuing the same content,
+// and the bytes reported with it are no more than the size of content.
+// The number of sn is bounded, the oldest one is dropped if cache is full
+type snCache struct {
+	lock    sync.Mutex
+	maxSize int
+	// sn => element of snEntry in order list
+	sns   map[int64]*list.Element
+	order *list.List
+}
+
+type snEntry struct {
+	sn        int64
+	expiredAt int64
+	// content requested with sn
+	content string
+	// size of content, 0 if not served yet
+	size int64
+	// bytes reported with sn
+	served int64
+}
+
+func newSnCache(maxSize int) *snCache {
+	return &snCache{maxSize: maxSize, sns: make(map[int64]*list.Element), order: list.New()}
+}
+
+// use mark sn as used for content until expiredAt (unix time), return false if sn was replayed.
+// A used sn is accepted again only by range request of the same content which was not served completely
+func (c *snCache) use(sn int64, expiredAt int64, content string, isRange bool) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.removeExpired(time.Now().Unix())
+
+	if e, exist := c.sns[sn]; exist {
+		entry := e.Value.(*snEntry)
+		return isRange && entry.content == content && (entry.size == 0 || entry.served < entry.size)
+	}
+
+	if c.order.Len() >= c.maxSize {
+		c.remove(c.order.Front())
+	}
+
+	c.sns[sn] = c.order.PushBack(&snEntry{sn: sn, expiredAt: expiredAt, content: content})
+	return true
+}
+
+// serve add n bytes served with sn, return the bytes should be reported,
+// the total of them is no more than size of content, so range requests do not inflate the upload
+func (c *snCache) serve(sn int64, n int64, size int64) int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	e, exist := c.sns[sn]
+	if !exist {
+		// sn was dropped from full cache, it may be reported already
+		return 0
+	}
+
+	entry := e.Value.(*snEntry)
+	entry.size = size
+	if n > size-entry.served {
+		n = size - entry.served
+	}
+	if n < 0 {
+		n = 0
+	}
+
+	entry.served += n
+	return n
+}
+
+// removeExpired remove the sn expired from front of list, the list is ordered by used time,
+// so it stops at the first sn not expired
+func (c *snCache) removeExpired(now int64) {
+	for e := c.order.Front(); e != nil; e = c.order.Front() {
+		if e.Value.(*snEntry).expiredAt >= now {
+			return
+		}
+		c.remove(e)
+	}
+}
+
+func (c *snCache) remove(e *list.Element) {
+	delete(c.sns, e.Value.(*snEntry).sn)
+	c.order.Remove(e)
+}
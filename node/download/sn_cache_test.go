@@ -0,0 +1,63 @@
+package download
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnCache(t *testing.T) {
+	now := time.Now().Unix()
+	c := newSnCache(2)
+
+	if !c.use(1, now-1, "content", false) || !c.use(2, now+60, "content", true) {
+		t.Fatal("sn 1 and 2 are not used")
+	}
+
+	// expired sn is removed, it is rejected by sign expired check instead
+	if _, exist := c.sns[1]; exist {
+		t.Fatal("expired sn 1 should be removed")
+	}
+
+	// range requests of sn 2 are reported, but no more than size of content
+	if n := c.serve(2, 60, 100); n != 60 {
+		t.Fatalf("report %d bytes of first range, expect 60", n)
+	}
+
+	if c.use(2, now+60, "content", false) {
+		t.Fatal("request of sn 2 without range is replayed")
+	}
+
+	if c.use(2, now+60, "other content", true) {
+		t.Fatal("range request of sn 2 for other content is replayed")
+	}
+
+	if !c.use(2, now+60, "content", true) {
+		t.Fatal("range request of sn 2 continuing the content should be accepted")
+	}
+
+	if n := c.serve(2, 60, 100); n != 40 {
+		t.Fatalf("report %d bytes of second range, expect 40", n)
+	}
+
+	// content of sn 2 was served completely
+	if c.use(2, now+60, "content", true) {
+		t.Fatal("range request of sn 2 after content served is replayed")
+	}
+
+	// cache is full, the oldest sn 2 is dropped
+	c.use(3, now+60, "content", false)
+	c.use(4, now+60, "content", false)
+
+	if c.order.Len() != 2 {
+		t.Fatalf("cache size %d, expect 2", c.order.Len())
+	}
+
+	if _, exist := c.sns[2]; exist {
+		t.Fatal("oldest sn 2 should be dropped")
+	}
+
+	// sn dropped from cache is treated as reported
+	if n := c.serve(2, 100, 100); n != 0 {
+		t.Fatalf("report %d bytes of dropped sn, expect 0", n)
+	}
+}
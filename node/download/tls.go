@@ -0,0 +1,151 @@
+package download
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/linguohua/titan/node/helper"
+)
+
+const (
+	// validity of self-signed certificate of download server
+	selfSignedCertValidity = 10 * 365 * 24 * time.Hour
+
+	selfSignedCertFile = "download-srv.crt"
+	selfSignedKeyFile  = "download-srv.key"
+)
+
+// SelfSignedCertFiles return the self-signed certificate and key file of download server in dir,
+// they are generated if not exist or the hosts are changed, so the fingerprint is not changed after restart
+func SelfSignedCertFiles(dir string, hosts []string) (string, string, error) {
+	certFile := filepath.Join(dir, selfSignedCertFile)
+	keyFile := filepath.Join(dir, selfSignedKeyFile)
+
+	_, keyErr := os.Stat(keyFile)
+	if keyErr == nil && certMatchHosts(certFile, hosts) {
+		return certFile, keyFile, nil
+	}
+
+	log.Infof("generate self-signed certificate %s for %v", certFile, hosts)
+	return certFile, keyFile, GenerateSelfSignedCert(certFile, keyFile, hosts)
+}
+
+// certMatchHosts return true if the certificate file exist and its SANs are the hosts,
+// the external and internal ip of node may change, SANs of certificate are stale after that
+func certMatchHosts(certFile string, hosts []string) bool {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return false
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return false
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false
+	}
+
+	sans := make([]string, 0, len(cert.IPAddresses)+len(cert.DNSNames))
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.DNSNames...)
+
+	expect := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			expect = append(expect, ip.String())
+		} else if host != "" {
+			expect = append(expect, host)
+		}
+	}
+
+	sort.Strings(sans)
+	sort.Strings(expect)
+	return reflect.DeepEqual(sans, expect)
+}
+
+// GenerateSelfSignedCert generate a self-signed certificate of download server for hosts,
+// client pin it with fingerprint which is registered to scheduler
+func GenerateSelfSignedCert(certFile, keyFile string, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{Organization: []string{"titan"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(selfSignedCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+}
+
+// loadTLSConfig load certificate of download server, fingerprint is not empty only if certificate is self-signed
+func loadTLSConfig(certFile, keyFile string) (*tls.Config, string, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, "", err
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, "", err
+	}
+
+	fingerprint := ""
+	selfSigned := bytes.Equal(leaf.RawIssuer, leaf.RawSubject) && leaf.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature) == nil
+	if selfSigned {
+		fingerprint = helper.CertFingerprint(leaf.Raw)
+	}
+
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, fingerprint, nil
+}
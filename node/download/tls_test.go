@@ -0,0 +1,53 @@
+package download
+
+import (
+	"testing"
+)
+
+func TestSelfSignedCert(t *testing.T) {
+	dir := t.TempDir()
+
+	certFile, keyFile, err := SelfSignedCertFiles(dir, []string{"127.0.0.1", "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, fingerprint, err := loadTLSConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fingerprint) != 64 {
+		t.Fatalf("fingerprint %s of self-signed certificate is not sha256", fingerprint)
+	}
+
+	// certificate is not generated again for the same hosts, fingerprint is not changed
+	_, _, err = SelfSignedCertFiles(dir, []string{"localhost", "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, again, err := loadTLSConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again != fingerprint {
+		t.Fatalf("fingerprint changed from %s to %s", fingerprint, again)
+	}
+
+	// ip of node is changed, certificate is generated again
+	_, _, err = SelfSignedCertFiles(dir, []string{"127.0.0.2", "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, changed, err := loadTLSConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changed == fingerprint || !certMatchHosts(certFile, []string{"127.0.0.2", "localhost"}) {
+		t.Fatalf("certificate is not generated again for changed hosts, fingerprint %s", changed)
+	}
+}
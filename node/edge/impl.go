@@ -21,19 +21,23 @@ var log = logging.Logger("edge")
 func NewLocalEdgeNode(ctx context.Context, device *device.Device, params *helper.NodeParams) api.Edge {
 	rateLimiter := rate.NewLimiter(rate.Limit(device.GetBandwidthUp()), int(device.GetBandwidthUp()))
 
-	block := block.NewBlock(params.DS, params.BlockStore, params.Scheduler, &block.Candidate{}, device, params.IPFSAPI)
+	block := block.NewBlock(params.DS, params.BlockStore, params.Scheduler, &block.Candidate{}, device, params.IPFSAPI, params.LoaderWorkers)
+	err := block.SetStorageQuota(params.StorageQuota, params.EvictPolicy)
+	if err != nil {
+		log.Panicf("NewLocalEdgeNode, SetStorageQuota error:%s", err.Error())
+	}
+	block.SetHotCache(params.HotCacheSize)
+	block.SetPartialBlockDir(params.PartialBlockDir)
 
 	validate := validate.NewValidate(block, device)
-	blockDownload := download.NewBlockDownload(rateLimiter, params, device, validate)
-
-	datasync.SyncLocalBlockstore(params.DS, params.BlockStore, block)
+	blockDownload := download.NewBlockDownload(rateLimiter, params, device, validate, block)
 
 	edge := &Edge{
 		Device:        device,
 		Block:         block,
 		BlockDownload: blockDownload,
 		Validate:      validate,
-		DataSync:      datasync.NewDataSync(block, params.DS),
+		DataSync:      datasync.NewDataSync(block, params),
 	}
 
 	return edge
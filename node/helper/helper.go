@@ -1,11 +1,15 @@
 package helper
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
 	"github.com/linguohua/titan/api"
 	"github.com/linguohua/titan/blockstore"
 	mh "github.com/multiformats/go-multihash"
@@ -14,7 +18,13 @@ import (
 const (
 	Batch = 5
 	// number download block if failed
-	BlockDownloadRetryNum = 1
+	BlockDownloadRetryNum = 3
+	// seconds, wait before retry, double after every retry
+	BlockDownloadRetryBackoff = 1
+	// seconds, max wait before retry
+	BlockDownloadRetryBackoffMax = 8
+	// ask scheduler for another source after download from the assigned source failed so many times
+	BlockDownloadSwitchSourceNum = 2
 	// Millisecond
 	LoadBockTick = 10
 	// validate timeout
@@ -23,13 +33,25 @@ const (
 	SchedulerApiTimeout = 3
 	// seconds
 	BlockDownloadTimeout = 15
+	// seconds, allowed clock difference between scheduler and node when check sign expired
+	DownloadSignClockSkew = 60
+	// max number of used sn remembered by download server
+	DownloadSnCacheSize = 100000
+	// max number of blocks in manifest of batch download
+	BatchDownloadMaxBlocks = 10000
 
 	DownloadSrvPath          = "/block/get"
+	DownloadCarfileSrvPath   = "/carfile/get"
+	DownloadCacheSrvPath     = "/block/cache"
+	DownloadGatewaySrvPath   = "/ipfs/"
+	DownloadBatchSrvPath     = "/block/batch"
 	DownloadTokenExpireAfter = 24 * time.Hour
 
-	KeyFidPrefix     = "fid/"
-	KeyCidPrefix     = "hash/"
-	TcpPackMaxLength = 52428800
+	KeyFidPrefix       = "fid/"
+	KeyCidPrefix       = "hash/"
+	KeyBlockMetaPrefix = "meta/"
+	KeyCacheReqPrefix  = "cachereq/"
+	TcpPackMaxLength   = 52428800
 )
 
 type NodeParams struct {
@@ -40,6 +62,24 @@ type NodeParams struct {
 	DownloadSrvKey  string
 	DownloadSrvAddr string
 	IPFSAPI         string
+	// max size of block store, 0 means no limit
+	StorageQuota int64
+	EvictPolicy  string
+	// max size of in-memory block cache of download server, 0 means disable
+	HotCacheSize int64
+	// reconcile block store every interval, 0 means only reconcile at start
+	ReconcileInterval time.Duration
+	// max keys checked per second by reconcile, 0 means no limit
+	ReconcileRate int
+	// number of workers load blocks concurrently
+	LoaderWorkers int
+	// load blocks from peers with bitswap instead of ipfs api, nil means disable
+	Exchange exchange.Interface
+	// certificate and key file of download server, serve https if set
+	DownloadSrvCertFile string
+	DownloadSrvKeyFile  string
+	// directory of partially downloaded blocks, under node repo
+	PartialBlockDir string
 }
 
 func NewKeyFID(fid string) datastore.Key {
@@ -52,6 +92,17 @@ func NewKeyHash(cid string) datastore.Key {
 	return datastore.NewKey(key)
 }
 
+func NewKeyBlockMeta(hash string) datastore.Key {
+	key := fmt.Sprintf("%s%s", KeyBlockMetaPrefix, hash)
+	return datastore.NewKey(key)
+}
+
+// NewKeyCacheReq key of block waiting for cache, carfileHash/fid
+func NewKeyCacheReq(carfileHash string, fid int) datastore.Key {
+	key := fmt.Sprintf("%s%s/%d", KeyCacheReqPrefix, carfileHash, fid)
+	return datastore.NewKey(key)
+}
+
 func CIDString2HashString(cidString string) (string, error) {
 	cid, err := cid.Decode(cidString)
 	if err != nil {
@@ -61,6 +112,42 @@ func CIDString2HashString(cidString string) (string, error) {
 	return cid.Hash().String(), nil
 }
 
+// BatchManifestHash return the hash of cids in manifest of batch download, scheduler sign it instead of cid
+func BatchManifestHash(cids []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(cids, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// HasLinksSize return true if links of the block carry the size of linked DAG,
+// only dag-pb links have size, links of dag-cbor and dag-json have no size
+func HasLinksSize(cidStr string) bool {
+	c, err := cid.Decode(cidStr)
+	if err != nil {
+		return false
+	}
+
+	codec := c.Prefix().Codec
+	return codec == cid.DagProtobuf || codec == cid.Raw
+}
+
+// CertFingerprint return hex of sha256 of DER certificate, client pin the self-signed certificate with it
+func CertFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// CarfileSignContent return the content scheduler sign instead of cid for carfile download,
+// so the sign of a block can not download the whole DAG of it
+func CarfileSignContent(carfileCid string) string {
+	return "carfile:" + carfileCid
+}
+
+// GatewaySignContent return the content scheduler sign instead of cid for gateway download,
+// so the sign of a block or carfile can not download the paths under it with gateway
+func GatewaySignContent(rootCid string) string {
+	return "gateway:" + rootCid
+}
+
 func HashString2CidString(hashString string) (string, error) {
 	multihash, err := mh.FromHexString(hashString)
 	if err != nil {
@@ -38,6 +38,69 @@ func (s *Scheduler) CacheResult(ctx context.Context, deviceID string, info api.C
 	return s.dataManager.CacheCarfileResult(&info)
 }
 
+// NodeCacheQueueResumed node reload the cache queue after restart
+func (s *Scheduler) NodeCacheQueueResumed(ctx context.Context, stat api.CacheStat, queue []api.CacheQueueInfo) error {
+	deviceID := handler.GetDeviceID(ctx)
+
+	if !isDeviceExists(deviceID, 0) {
+		return xerrors.Errorf("node not Exist: %s", deviceID)
+	}
+
+	var nextTimeout int64
+	if cNode := s.nodeManager.GetCandidateNode(deviceID); cNode != nil {
+		cNode.UpdateCacheStat(&stat)
+		nextTimeout = cNode.GetCacheNextTimeoutTimeStamp()
+	} else if eNode := s.nodeManager.GetEdgeNode(deviceID); eNode != nil {
+		eNode.UpdateCacheStat(&stat)
+		nextTimeout = eNode.GetCacheNextTimeoutTimeStamp()
+	} else {
+		return xerrors.Errorf("not found node:%s", deviceID)
+	}
+
+	timeout := nextTimeout - time.Now().Unix()
+	for _, info := range queue {
+		log.Infof("NodeCacheQueueResumed, device %s, carfile %s, cacheID %s, blocks %d", deviceID, info.CarfileHash, info.CacheID, info.BlockCount)
+		s.dataManager.ResumeCacheTask(info.CarfileHash, info.CacheID, timeout)
+	}
+
+	return nil
+}
+
+// NodeAllocateFids allocate fids for the blocks imported by node, return the first fid of the range
+func (s *Scheduler) NodeAllocateFids(ctx context.Context, count int) (int, error) {
+	deviceID := handler.GetDeviceID(ctx)
+
+	if !isDeviceExists(deviceID, 0) {
+		return 0, xerrors.Errorf("node not Exist: %s", deviceID)
+	}
+
+	if count <= 0 {
+		return 0, xerrors.Errorf("count is %d", count)
+	}
+
+	maxFid, err := cache.GetDB().IncrNodeCacheFid(deviceID, count)
+	if err != nil {
+		return 0, xerrors.Errorf("deviceID:%s,IncrNodeCacheFid err:%s", deviceID, err.Error())
+	}
+
+	return maxFid - count + 1, nil
+}
+
+// NodeImportCarfile node imported carfile to block store, return the cache of node
+func (s *Scheduler) NodeImportCarfile(ctx context.Context, info api.ImportCarfileInfo) (api.ImportCacheInfo, error) {
+	deviceID := handler.GetDeviceID(ctx)
+
+	if !isDeviceExists(deviceID, 0) {
+		return api.ImportCacheInfo{}, xerrors.Errorf("node not Exist: %s", deviceID)
+	}
+
+	if info.CarfileCid == "" || len(info.Blocks) == 0 {
+		return api.ImportCacheInfo{}, xerrors.New("parameter is nil")
+	}
+
+	return s.dataManager.ImportCarfile(deviceID, &info)
+}
+
 // ResetCacheExpiredTime reset expired time with data cache
 func (s *Scheduler) ResetCacheExpiredTime(ctx context.Context, carfileCid, cacheID string, expiredTime time.Time) error {
 	if time.Now().After(expiredTime) {
@@ -217,8 +280,8 @@ func (s *Scheduler) RemoveCache(ctx context.Context, carfileID, cacheID string)
 	return s.dataManager.RemoveCache(carfileID, cacheID)
 }
 
-// CacheCarfile Cache Carfile
-func (s *Scheduler) CacheCarfile(ctx context.Context, cid string, reliability int, expiredTime time.Time) error {
+// CacheCarfile Cache Carfile, carfile with higher priority is cached first by nodes
+func (s *Scheduler) CacheCarfile(ctx context.Context, cid string, reliability, priority int, expiredTime time.Time) error {
 	if cid == "" {
 		return xerrors.New("Cid is Nil")
 	}
@@ -233,7 +296,7 @@ func (s *Scheduler) CacheCarfile(ctx context.Context, cid string, reliability in
 
 	// expiredTime := time.Now().Add(time.Duration(hour) * time.Hour)
 
-	return s.dataManager.CacheData(cid, reliability, expiredTime)
+	return s.dataManager.CacheData(cid, reliability, priority, expiredTime)
 }
 
 // DeleteBlockRecords  Delete Block Record
@@ -242,15 +305,59 @@ func (s *Scheduler) DeleteBlockRecords(ctx context.Context, deviceID string, cid
 		return nil, xerrors.New("Cid is Nil")
 	}
 
-	// edge := s.nodeManager.getEdgeNode(deviceID)
-	// if edge != nil {
-	// 	return edge.deleteBlockRecords(cids)
-	// }
+	if s.nodeManager.GetEdgeNode(deviceID) == nil && s.nodeManager.GetCandidateNode(deviceID) == nil {
+		return nil, xerrors.Errorf("not found node:%s", deviceID)
+	}
 
-	// candidate := s.nodeManager.getCandidateNode(deviceID)
-	// if candidate != nil {
-	// 	return candidate.deleteBlockRecords(cids)
-	// }
+	// the blocks was deleted in node, only remove the records of blocks
+	failed, hashes := cidsToHashes(cids)
+	if len(hashes) > 0 {
+		err := s.dataManager.RemoveBlockRecords(deviceID, hashes)
+		if err != nil {
+			return failed, err
+		}
+	}
+
+	return failed, nil
+}
+
+// NodeReportCorruptedBlocks the blocks of node were corrupted, restore the caches of blocks
+func (s *Scheduler) NodeReportCorruptedBlocks(ctx context.Context, cids []string) error {
+	deviceID := handler.GetDeviceID(ctx)
+
+	if len(cids) <= 0 {
+		return xerrors.New("Cid is Nil")
+	}
+
+	if s.nodeManager.GetEdgeNode(deviceID) == nil && s.nodeManager.GetCandidateNode(deviceID) == nil {
+		return xerrors.Errorf("node not online: %s", deviceID)
+	}
+
+	_, hashes := cidsToHashes(cids)
+	if len(hashes) <= 0 {
+		return nil
+	}
+
+	err := s.dataManager.RestoreCorruptedBlocks(deviceID, hashes)
+	if err != nil && !persistent.GetDB().IsNilErr(err) {
+		return err
+	}
+
+	return nil
+}
+
+// cidsToHashes convert cids to hashes, return the cids that failed to convert
+func cidsToHashes(cids []string) (map[string]string, []string) {
+	failed := make(map[string]string)
+	hashes := make([]string, 0, len(cids))
+	for _, cid := range cids {
+		hash, err := helper.CIDString2HashString(cid)
+		if err != nil {
+			failed[cid] = err.Error()
+			continue
+		}
+		hashes = append(hashes, hash)
+	}
 
-	return nil, xerrors.Errorf("not found node:%s", deviceID)
+	return failed, hashes
 }
@@ -2,7 +2,9 @@ package data
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
+	"net/url"
 	"sort"
 	"strings"
 	"sync"
@@ -11,6 +13,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/linguohua/titan/api"
 	"github.com/linguohua/titan/node/helper"
+	titanRsa "github.com/linguohua/titan/node/rsa"
 	"github.com/linguohua/titan/node/scheduler/db/cache"
 	"github.com/linguohua/titan/node/scheduler/db/persistent"
 	"github.com/linguohua/titan/node/scheduler/node"
@@ -20,6 +23,12 @@ import (
 // If the node disk size is greater than this value, caching will not continue
 const diskUsageMax = 90
 
+// source of the blocks imported by node
+const importSource = "Import"
+
+// seconds, token of peer edge download server for caching expired after it
+const edgeDownloadTokenTimeout = 30 * 60
+
 // Cache Cache
 type Cache struct {
 	data *Data
@@ -36,6 +45,8 @@ type Cache struct {
 	isRootCache bool
 	expiredTime time.Time
 	lock        *sync.Mutex
+	// blocks were imported by node, all of them were allocated before node report result
+	imported bool
 
 	alreadyCacheBlockMap sync.Map
 }
@@ -271,8 +282,10 @@ func (c *Cache) searchAppropriateNode(filterMap map[string]string, index int, in
 	return
 }
 
-func (c *Cache) findNodeAndBlockMapWithHash(hash string) (map[string]string, *node.CandidateNode, error) {
+// find the nodes holding the block, return a candidate and the online edges which can be the source of block
+func (c *Cache) findNodeAndBlockMapWithHash(hash string) (map[string]string, *node.CandidateNode, []*node.EdgeNode, error) {
 	var fromNode *node.CandidateNode
+	fromEdges := make([]*node.EdgeNode, 0)
 
 	froms, err := persistent.GetDB().GetNodesWithBlock(hash, true)
 	if err == nil {
@@ -288,13 +301,42 @@ func (c *Cache) findNodeAndBlockMapWithHash(hash string) (map[string]string, *no
 						fromNode = node
 					}
 				}
+
+				// the edge with self-signed certificate is pinned by peer edge with the fingerprint
+				if edge := c.data.nodeManager.GetEdgeNode(dID); edge != nil {
+					fromEdges = append(fromEdges, edge)
+				}
 			}
 		}
 
-		return filterMap, fromNode, nil
+		return filterMap, fromNode, fromEdges, nil
+	}
+
+	return nil, nil, nil, err
+}
+
+// edgeDownloadSource return the url of peer edge download server for caching and the token of blocks,
+// the sign of every block is in BlockCacheInfo
+func (c *Cache) edgeDownloadSource(edge *node.EdgeNode, signTime int64) (string, string) {
+	query := url.Values{}
+	query.Set("carfile", c.data.carfileHash)
+	query.Set("signTime", fmt.Sprintf("%d", signTime))
+	query.Set("timeout", fmt.Sprintf("%d", edgeDownloadTokenTimeout))
+
+	downloadURL := strings.TrimSuffix(edge.GetDownloadSrvURL(), helper.DownloadSrvPath) + helper.DownloadCacheSrvPath
+	return downloadURL, query.Encode()
+}
+
+// edgeBlockSign sign the block with the key of peer edge, so the block can be downloaded from peer edge for caching,
+// the sign expired after edgeDownloadTokenTimeout
+func (c *Cache) edgeBlockSign(edge *node.EdgeNode, hash string, signTime int64) (string, error) {
+	content := fmt.Sprintf("%s%s%d%d", c.data.carfileHash, hash, signTime, edgeDownloadTokenTimeout)
+	sign, err := titanRsa.RsaSign(edge.GetPrivateKey(), content)
+	if err != nil {
+		return "", err
 	}
 
-	return nil, nil, err
+	return hex.EncodeToString(sign), nil
 }
 
 // Allocate blocks to nodes
@@ -309,6 +351,7 @@ func (c *Cache) allocateBlocksToNodes(cidMap map[string]string, isStarted bool,
 	}
 
 	index := 0
+	signTime := time.Now().Unix()
 	for cid, dbID := range cidMap {
 		cError := &api.CacheError{CID: cid, Time: time.Now()}
 
@@ -330,7 +373,7 @@ func (c *Cache) allocateBlocksToNodes(cidMap map[string]string, isStarted bool,
 		fromNodeID := "IPFS"
 		fid := 0
 
-		filterMap, fromNode, err := c.findNodeAndBlockMapWithHash(hash)
+		filterMap, fromNode, fromEdges, err := c.findNodeAndBlockMapWithHash(hash)
 		if err != nil {
 			cError.Msg = fmt.Sprintf("find hash err:%s", err.Error())
 			cacheErrorList = append(cacheErrorList, cError)
@@ -349,6 +392,20 @@ func (c *Cache) allocateBlocksToNodes(cidMap map[string]string, isStarted bool,
 				}
 				status = api.CacheStatusCreate
 
+				// edge load the block from a peer edge, so candidates are not the bottleneck of popular carfile
+				var fromEdge *node.EdgeNode
+				blockSign := ""
+				if len(fromEdges) > 0 && c.data.nodeManager.GetEdgeNode(deviceID) != nil {
+					edge := fromEdges[index%len(fromEdges)]
+					blockSign, err = c.edgeBlockSign(edge, hash, signTime)
+					if err != nil {
+						log.Errorf("allocateBlocksToNodes, edge %s sign block error:%s", edge.DeviceId, err.Error())
+					} else {
+						fromEdge = edge
+						fromNodeID = edge.DeviceId
+					}
+				}
+
 				reqDataMap, exist := nodeReqCacheDataMap[deviceID]
 				if !exist {
 					reqDataMap = map[string]*api.ReqCacheData{}
@@ -360,13 +417,19 @@ func (c *Cache) allocateBlocksToNodes(cidMap map[string]string, isStarted bool,
 					reqData.BlockInfos = make([]api.BlockCacheInfo, 0)
 					reqData.CardFileHash = c.data.carfileHash
 					reqData.CacheID = c.cacheID
-					if fromNode != nil {
+					reqData.Reliability = c.data.needReliability
+					reqData.Priority = c.data.priority
+					if fromEdge != nil {
+						reqData.DownloadURL, reqData.DownloadToken = c.edgeDownloadSource(fromEdge, signTime)
+						reqData.FromEdge = true
+						reqData.DownloadCertFingerprint = fromEdge.GetDownloadSrvCertFingerprint()
+					} else if fromNode != nil {
 						reqData.DownloadURL = fromNode.GetAddress()
 						reqData.DownloadToken = string(c.data.nodeManager.GetAuthToken())
 					}
 				}
 
-				reqData.BlockInfos = append(reqData.BlockInfos, api.BlockCacheInfo{Cid: cid, Fid: fid})
+				reqData.BlockInfos = append(reqData.BlockInfos, api.BlockCacheInfo{Cid: cid, Fid: fid, Sign: blockSign})
 				reqDataMap[fromNodeID] = reqData
 				// cList = append(cList, &api.BlockCacheInfo{Cid: cid, Fid: fid, From: from})
 				nodeReqCacheDataMap[deviceID] = reqDataMap
@@ -406,6 +469,103 @@ func (c *Cache) allocateBlocksToNodes(cidMap map[string]string, isStarted bool,
 	return saveDBblockList, nodeReqCacheDataMap
 }
 
+// check fids of the imported blocks were allocated by NodeAllocateFids and not used by other blocks of the node
+func validateImportFids(deviceID string, blocks []api.BlockCacheInfo) error {
+	maxFid, err := cache.GetDB().GetNodeCacheFid(deviceID)
+	if err != nil {
+		return xerrors.Errorf("validateImportFids %s GetNodeCacheFid err:%s", deviceID, err.Error())
+	}
+
+	fidMap := make(map[int]string, len(blocks))
+	startFid, endFid := 0, 0
+	for _, blockInfo := range blocks {
+		if blockInfo.Fid <= 0 || int64(blockInfo.Fid) > maxFid {
+			return xerrors.Errorf("validateImportFids fid %d of %s was not allocated, max fid %d", blockInfo.Fid, blockInfo.Cid, maxFid)
+		}
+
+		hash, err := helper.CIDString2HashString(blockInfo.Cid)
+		if err != nil {
+			return xerrors.Errorf("validateImportFids %s cid to hash err:%s", blockInfo.Cid, err.Error())
+		}
+
+		if other, exist := fidMap[blockInfo.Fid]; exist && other != hash {
+			return xerrors.Errorf("validateImportFids fid %d is duplicate", blockInfo.Fid)
+		}
+		fidMap[blockInfo.Fid] = hash
+
+		if startFid == 0 || blockInfo.Fid < startFid {
+			startFid = blockInfo.Fid
+		}
+		if blockInfo.Fid > endFid {
+			endFid = blockInfo.Fid
+		}
+	}
+
+	cidMap, err := persistent.GetDB().GetBlocksInRange(startFid, endFid, deviceID)
+	if err != nil {
+		return xerrors.Errorf("validateImportFids %s GetBlocksInRange err:%s", deviceID, err.Error())
+	}
+
+	for fid, cid := range cidMap {
+		hash, exist := fidMap[fid]
+		if !exist {
+			continue
+		}
+
+		usedHash, err := helper.CIDString2HashString(cid)
+		if err != nil || usedHash != hash {
+			return xerrors.Errorf("validateImportFids fid %d is used by %s", fid, cid)
+		}
+	}
+
+	return nil
+}
+
+// record the blocks imported by node, fid of blocks were allocated by node
+func (c *Cache) importBlocks(deviceID string, blocks []api.BlockCacheInfo) error {
+	err := validateImportFids(deviceID, blocks)
+	if err != nil {
+		return err
+	}
+
+	saveDBblockList := make([]*api.BlockInfo, 0, len(blocks))
+	for _, blockInfo := range blocks {
+		hash, err := helper.CIDString2HashString(blockInfo.Cid)
+		if err != nil {
+			return xerrors.Errorf("importBlocks %s cid to hash err:%s", blockInfo.Cid, err.Error())
+		}
+
+		if _, exist := c.alreadyCacheBlockMap.Load(hash); exist {
+			continue
+		}
+
+		b := &api.BlockInfo{
+			CacheID:     c.cacheID,
+			CarfileHash: c.carfileHash,
+			CID:         blockInfo.Cid,
+			DeviceID:    deviceID,
+			Status:      api.CacheStatusCreate,
+			FID:         blockInfo.Fid,
+			Source:      importSource,
+			CIDHash:     hash,
+		}
+
+		// root block was created with cache
+		if hash == c.carfileHash {
+			rootBlock, err := persistent.GetDB().GetBlockInfo(c.cacheID, hash)
+			if err != nil || rootBlock == nil {
+				return xerrors.Errorf("importBlocks cacheID:%s, GetBlockInfo err:%v", c.cacheID, err)
+			}
+			b.ID = rootBlock.ID
+		}
+
+		c.alreadyCacheBlockMap.Store(hash, deviceID)
+		saveDBblockList = append(saveDBblockList, b)
+	}
+
+	return persistent.GetDB().SaveCacheingResults(nil, nil, nil, saveDBblockList)
+}
+
 // Notify nodes to cache blocks and setting timeout
 func (c *Cache) sendBlocksToNodes(nodeCacheMap map[string]map[string]*api.ReqCacheData) {
 	if nodeCacheMap == nil || len(nodeCacheMap) <= 0 {
@@ -438,6 +598,34 @@ func (c *Cache) sendBlocksToNodes(nodeCacheMap map[string]map[string]*api.ReqCac
 	return
 }
 
+// blockCacheCancelled record the block which was not cached because the cache task was stopped
+func blockCacheCancelled(info *api.CacheResultInfo) error {
+	hash, err := helper.CIDString2HashString(info.Cid)
+	if err != nil {
+		return xerrors.Errorf("blockCacheCancelled %s cid to hash err:%s", info.Cid, err.Error())
+	}
+
+	blockInfo, err := persistent.GetDB().GetBlockInfo(info.CacheID, hash)
+	if err != nil || blockInfo == nil {
+		return xerrors.Errorf("blockCacheCancelled cacheID:%s,hash:%s,deviceID:%s, GetBlockInfo err:%v", info.CacheID, hash, info.DeviceID, err)
+	}
+
+	if blockInfo.Status == api.CacheStatusSuccess {
+		return xerrors.Errorf("blockCacheCancelled cacheID:%s,%s block saved ", info.CacheID, hash)
+	}
+
+	bInfo := &api.BlockInfo{
+		ID:          blockInfo.ID,
+		CacheID:     info.CacheID,
+		CID:         blockInfo.CID,
+		DeviceID:    info.DeviceID,
+		Status:      api.CacheStatusCancel,
+		CarfileHash: info.CarFileHash,
+	}
+
+	return persistent.GetDB().SaveCacheingResults(nil, nil, bInfo, nil)
+}
+
 func (c *Cache) blockCacheResult(info *api.CacheResultInfo) error {
 	hash, err := helper.CIDString2HashString(info.Cid)
 	if err != nil {
@@ -463,6 +651,10 @@ func (c *Cache) blockCacheResult(info *api.CacheResultInfo) error {
 			if hash == c.carfileHash {
 				c.totalSize = int(info.LinksSize) + info.BlockSize
 				c.totalBlocks = 1
+				// size of DAG without links size is known after the first cache of it was done
+				if !helper.HasLinksSize(info.Cid) {
+					c.totalSize = c.data.totalSize
+				}
 			}
 			c.totalBlocks += len(info.Links)
 		}
@@ -500,7 +692,7 @@ func (c *Cache) blockCacheResult(info *api.CacheResultInfo) error {
 
 	// log.Warnf("block:%s,Status:%v, link len:%d ", hash, blockInfo.Status, len(info.Links))
 	linkMap := make(map[string]string)
-	if len(info.Links) > 0 {
+	if len(info.Links) > 0 && !c.imported {
 		//TODO avoid loops
 		for _, link := range info.Links {
 			linkMap[link] = ""
@@ -610,6 +802,10 @@ func (c *Cache) endCache(unDoneBlocks int, status api.CacheStatus) (err error) {
 		c.status = api.CacheStatusFail
 	} else {
 		c.status = api.CacheStatusSuccess
+		// all blocks of DAG without links size are cached, the done size is the size of DAG
+		if !helper.HasLinksSize(c.data.carfileCid) {
+			c.totalSize = c.doneSize
+		}
 	}
 	c.reliability = c.calculateReliability("")
 
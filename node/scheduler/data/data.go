@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/helper"
 	"github.com/linguohua/titan/node/scheduler/db/cache"
 	"github.com/linguohua/titan/node/scheduler/db/persistent"
 	"github.com/linguohua/titan/node/scheduler/node"
@@ -25,6 +26,8 @@ type Data struct {
 	totalBlocks     int
 	nodes           int
 	expiredTime     time.Time
+	// priority of cache requests to nodes, it is not saved
+	priority int
 
 	CacheMap sync.Map
 }
@@ -165,6 +168,11 @@ func (d *Data) updateAndSaveCacheEndInfo(doneCache *Cache) error {
 	if doneCache.status == api.CacheStatusSuccess {
 		d.reliability += doneCache.reliability
 
+		// size of DAG without links size is known after the root cache was done
+		if doneCache.isRootCache && !helper.HasLinksSize(d.carfileCid) {
+			d.totalSize = doneCache.totalSize
+		}
+
 		err := cache.GetDB().IncrByBaseInfo(cache.CarFileCountField, 1)
 		if err != nil {
 			log.Errorf("updateAndSaveCacheEndInfo IncrByBaseInfo err: %s", err.Error())
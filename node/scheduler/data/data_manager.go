@@ -34,11 +34,16 @@ const (
 	eventTypeReplenishCacheTime  EventType = "Replenish_Cache_Expired"
 	eventTypeResetCacheTime      EventType = "Reset_Cache_Expired"
 	eventTypeRestoreCache        EventType = "Restore_Cache"
+	eventTypeImportCarfile       EventType = "Import_Carfile"
 
 	dataCacheTimerInterval    = 10     //  time interval (Second)
 	checkExpiredTimerInterval = 60 * 5 //  time interval (Second)
 
 	runningTaskMaxCount = 5
+
+	// timeout of import task (Second), extend it with the blocks count of every import batch
+	importTimeout         = 60
+	importBlocksPerSecond = 10
 	// blockResultThreadCount = 10
 )
 
@@ -155,7 +160,7 @@ func (m *Manager) doDataTask(info *api.DataInfo) error {
 			return err
 		}
 	} else {
-		err := m.makeDataTask(info.CarfileCid, info.CarfileHash, info.NeedReliability, info.ExpiredTime)
+		err := m.makeDataTask(info.CarfileCid, info.CarfileHash, info.NeedReliability, info.Priority, info.ExpiredTime)
 		if err != nil {
 			return err
 		}
@@ -211,7 +216,7 @@ func (m *Manager) checkTaskTimeouts() {
 	}
 }
 
-func (m *Manager) makeDataTask(cid, hash string, reliability int, expiredTime time.Time) error {
+func (m *Manager) makeDataTask(cid, hash string, reliability, priority int, expiredTime time.Time) error {
 	var err error
 	data := m.GetData(hash)
 	if data == nil {
@@ -224,6 +229,7 @@ func (m *Manager) makeDataTask(cid, hash string, reliability int, expiredTime ti
 		data.needReliability = reliability
 		data.expiredTime = expiredTime
 	}
+	data.priority = priority
 
 	// log.Warnf("askCacheData reliability:%d,data.needReliability:%d,data.reliability:%d", reliability, data.needReliability, data.reliability)
 
@@ -280,18 +286,18 @@ func (m *Manager) makeDataContinue(hash, cacheID string) error {
 }
 
 // CacheData new data task
-func (m *Manager) CacheData(cid string, reliability int, expiredTime time.Time) error {
+func (m *Manager) CacheData(cid string, reliability, priority int, expiredTime time.Time) error {
 	hash, err := helper.CIDString2HashString(cid)
 	if err != nil {
 		return xerrors.Errorf("%s cid to hash err:", cid, err.Error())
 	}
 
-	err = cache.GetDB().SetWaitingDataTask(&api.DataInfo{CarfileHash: hash, CarfileCid: cid, NeedReliability: reliability, ExpiredTime: expiredTime})
+	err = cache.GetDB().SetWaitingDataTask(&api.DataInfo{CarfileHash: hash, CarfileCid: cid, NeedReliability: reliability, ExpiredTime: expiredTime, Priority: priority})
 	if err != nil {
 		return err
 	}
 
-	err = saveEvent(cid, "", "user", fmt.Sprintf("reliability:%d", reliability), eventTypeAddNewDataTask)
+	err = saveEvent(cid, "", "user", fmt.Sprintf("reliability:%d,priority:%d", reliability, priority), eventTypeAddNewDataTask)
 	if err != nil {
 		return err
 	}
@@ -393,6 +399,15 @@ func (m *Manager) RemoveCache(carfileCid, cacheID string) error {
 
 // CacheCarfileResult block cache result
 func (m *Manager) CacheCarfileResult(info *api.CacheResultInfo) (err error) {
+	if info.Cancelled {
+		// node cancel caching after the task was stopped, only record the blocks,
+		// if the task is still running, the block is handled as failed
+		isRunning, err := m.isDataTaskRunnning(info.CarFileHash, info.CacheID)
+		if err == nil && !isRunning {
+			return blockCacheCancelled(info)
+		}
+	}
+
 	var data *Data
 	dI, exist := m.dataMap.Load(info.CarFileHash)
 	if exist && dI != nil {
@@ -428,6 +443,109 @@ func (m *Manager) CacheCarfileResult(info *api.CacheResultInfo) (err error) {
 	return
 }
 
+// ImportCarfile record the blocks imported by node, the first batch create a new cache of the carfile,
+// blocks will be success after node report them with CacheResult
+func (m *Manager) ImportCarfile(deviceID string, info *api.ImportCarfileInfo) (api.ImportCacheInfo, error) {
+	hash, err := helper.CIDString2HashString(info.CarfileCid)
+	if err != nil {
+		return api.ImportCacheInfo{}, xerrors.Errorf("%s cid to hash err:%s", info.CarfileCid, err.Error())
+	}
+
+	var c *Cache
+	if info.CacheID == "" {
+		c, err = m.newImportCache(info.CarfileCid, hash, info.ExpiredTime)
+		if err != nil {
+			return api.ImportCacheInfo{}, err
+		}
+	} else {
+		isRunning, err := m.isDataTaskRunnning(hash, info.CacheID)
+		if err != nil || !isRunning {
+			return api.ImportCacheInfo{}, xerrors.Errorf("data not running : %s,%s ,err:%v", info.CacheID, info.CarfileCid, err)
+		}
+
+		data := m.GetData(hash)
+		if data == nil {
+			return api.ImportCacheInfo{}, xerrors.Errorf("not found data task: %s", hash)
+		}
+
+		cacheI, exist := data.CacheMap.Load(info.CacheID)
+		if !exist {
+			return api.ImportCacheInfo{}, xerrors.Errorf("not found cacheID:%s", info.CacheID)
+		}
+		c = cacheI.(*Cache)
+	}
+
+	err = c.importBlocks(deviceID, info.Blocks)
+	if err != nil {
+		return api.ImportCacheInfo{}, err
+	}
+
+	m.updateDataTimeout(hash, c.cacheID, importTimeout, int64(len(info.Blocks)/importBlocksPerSecond))
+
+	return api.ImportCacheInfo{CacheID: c.cacheID, Reliability: c.data.needReliability}, nil
+}
+
+func (m *Manager) newImportCache(cid, hash string, expiredTime time.Time) (*Cache, error) {
+	isRunning, err := m.isDataTaskRunnning(hash, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if isRunning {
+		return nil, xerrors.Errorf("data task is running: %s", cid)
+	}
+
+	data := m.GetData(hash)
+	if data == nil {
+		data = newData(m.nodeManager, m, cid, hash, 0)
+	}
+
+	// imported cache is the only one wanted, do not dispatch other caches after it
+	if data.needReliability <= data.reliability {
+		data.needReliability = data.reliability + 1
+	}
+
+	if expiredTime.After(data.expiredTime) {
+		data.expiredTime = expiredTime
+	}
+
+	err = persistent.GetDB().SetDataInfo(&api.DataInfo{
+		CarfileCid:      data.carfileCid,
+		TotalSize:       data.totalSize,
+		NeedReliability: data.needReliability,
+		Reliability:     data.reliability,
+		CacheCount:      data.cacheCount,
+		TotalBlocks:     data.totalBlocks,
+		ExpiredTime:     data.expiredTime,
+		CarfileHash:     data.carfileHash,
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("cid:%s,SetDataInfo err:%s", data.carfileCid, err.Error())
+	}
+
+	c, _, err := newCache(data, !data.existRootCache())
+	if err != nil {
+		return nil, err
+	}
+	c.imported = true
+
+	data.CacheMap.Store(c.cacheID, c)
+	data.cacheCount = data.reliability + 1
+
+	err = cache.GetDB().SetDataTaskToRunningList(hash, c.cacheID)
+	if err != nil {
+		return nil, xerrors.Errorf("newImportCache %s , SetDataTaskToRunningList err:%s", hash, err.Error())
+	}
+
+	err = saveEvent(cid, c.cacheID, "", "", eventTypeImportCarfile)
+	if err != nil {
+		log.Errorf("newImportCache saveEvent err:%s", err.Error())
+	}
+
+	m.recordTaskStart(data)
+	return c, nil
+}
+
 // func (m *Manager) doCacheResults() {
 // 	size := int(cache.GetDB().GetCacheResultNum())
 // 	if size <= 0 {
@@ -674,6 +792,20 @@ func (m *Manager) isDataTaskRunnning(hash, cacheID string) (bool, error) {
 	return cID == cacheID, nil
 }
 
+// ResumeCacheTask node resumed the blocks of cache after restart, extend the timeout of running task
+func (m *Manager) ResumeCacheTask(carfileHash, cacheID string, timeoutSecond int64) {
+	isRunning, err := m.isDataTaskRunnning(carfileHash, cacheID)
+	if err != nil || !isRunning {
+		return
+	}
+
+	if timeoutSecond <= 0 {
+		timeoutSecond = 15
+	}
+
+	m.updateDataTimeout(carfileHash, cacheID, timeoutSecond, 0)
+}
+
 // ReplenishExpiredTimeToData replenish time
 func (m *Manager) ReplenishExpiredTimeToData(cid, cacheID string, hour int) error {
 	hash, err := helper.CIDString2HashString(cid)
@@ -791,25 +923,62 @@ func (m *Manager) CleanNodeAndRestoreCaches(deviceIDs []string) {
 	// log.Warnf("recacheMap : %v", recacheMap)
 	// recache
 	for carfileHash, deviceID := range recacheMap {
-		info, err := persistent.GetDB().GetDataInfo(carfileHash)
+		err := restoreCache(carfileHash, deviceID, fmt.Sprintf("%s quitted", deviceID))
 		if err != nil {
-			log.Errorf("cleanNodeAndRestoreCaches GetDataInfo err:%s", err.Error())
-			continue
+			log.Errorf("cleanNodeAndRestoreCaches restoreCache err:%s", err.Error())
 		}
+	}
+}
 
-		// Restore cache
-		err = cache.GetDB().SetWaitingDataTask(&api.DataInfo{CarfileHash: carfileHash, CarfileCid: info.CarfileCid, NeedReliability: info.NeedReliability, ExpiredTime: info.ExpiredTime})
-		if err != nil {
-			log.Errorf("cleanNodeAndRestoreCaches SetWaitingDataTask err:%s", err.Error())
-			continue
-		}
+// RestoreCorruptedBlocks the blocks of node were corrupted, restore the caches of blocks
+func (m *Manager) RestoreCorruptedBlocks(deviceID string, hashes []string) error {
+	carfileMap, err := persistent.GetDB().UpdateCacheInfoOfCorruptedBlocks(deviceID, hashes)
+	if err != nil {
+		return err
+	}
 
-		err = persistent.GetDB().SetEventInfo(&api.EventInfo{CID: info.CarfileCid, DeviceID: deviceID, Msg: fmt.Sprintf("%s quitted", deviceID), Event: string(eventTypeRestoreCache)})
+	for carfileHash := range carfileMap {
+		err = restoreCache(carfileHash, deviceID, fmt.Sprintf("%d blocks of %s corrupted", len(hashes), deviceID))
 		if err != nil {
-			log.Errorf("cleanNodeAndRestoreCaches SetEventInfo err:%s", err.Error())
-			continue
+			log.Errorf("RestoreCorruptedBlocks restoreCache err:%s", err.Error())
 		}
 	}
+
+	return nil
+}
+
+// RemoveBlockRecords the blocks were deleted by node, remove the records of blocks without restoring caches
+func (m *Manager) RemoveBlockRecords(deviceID string, hashes []string) error {
+	count, err := persistent.GetDB().RemoveBlocksOfDevice(deviceID, hashes)
+	if err != nil {
+		return err
+	}
+
+	if count <= 0 {
+		return nil
+	}
+
+	err = cache.GetDB().IncrByDevicesInfo(cache.BlockCountField, map[string]int64{deviceID: -count})
+	if err != nil {
+		log.Errorf("RemoveBlockRecords IncrByDevicesInfo err:%s", err.Error())
+	}
+
+	return nil
+}
+
+func restoreCache(carfileHash, deviceID, msg string) error {
+	info, err := persistent.GetDB().GetDataInfo(carfileHash)
+	if err != nil {
+		return xerrors.Errorf("GetDataInfo %s err:%s", carfileHash, err.Error())
+	}
+
+	// Restore cache
+	err = cache.GetDB().SetWaitingDataTask(&api.DataInfo{CarfileHash: carfileHash, CarfileCid: info.CarfileCid, NeedReliability: info.NeedReliability, ExpiredTime: info.ExpiredTime})
+	if err != nil {
+		return xerrors.Errorf("SetWaitingDataTask %s err:%s", carfileHash, err.Error())
+	}
+
+	return persistent.GetDB().SetEventInfo(&api.EventInfo{CID: info.CarfileCid, DeviceID: deviceID, Msg: msg, Event: string(eventTypeRestoreCache)})
 }
 
 // //RedressCacheDataInfo redress cache data info
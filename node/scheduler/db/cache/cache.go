@@ -157,4 +157,6 @@ type DownloadBlockRecord struct {
 	UserStatus    int    `redis:"UserStatus"`
 	SignTime      int64  `redis:"SignTime"`
 	Timeout       int    `redis:"Timeout"`
+	// content signed instead of cid, manifest hash of batch download or carfile sign content of carfile download
+	Manifest string `redis:"Manifest"`
 }
@@ -59,11 +59,14 @@ type DB interface {
 	GetNodesFromCache(cacheID string) ([]string, error)
 	GetNodesFromDataCache(hash, cacheID string) (dataOut, cacheOut []string)
 	UpdateCacheInfoOfQuitNode(deviceID string) (successCacheCount int, carfileReliabilitys map[string]int, err error)
+	UpdateCacheInfoOfCorruptedBlocks(deviceID string, hashes []string) (carfileReliabilitys map[string]int, err error)
+	RemoveBlocksOfDevice(deviceID string, hashes []string) (int64, error)
 	GetBlocksFID(deviceID string) (map[int]string, error)
 	GetBlocksInRange(startFid, endFid int, deviceID string) (map[int]string, error)
 	GetBlocksBiggerThan(startFid int, deviceID string) (map[int]string, error)
 	CountCidOfDevice(deviceID string) (int64, error)
 	GetNodesWithBlock(hash string, isSuccess bool) ([]string, error)
+	GetNodesWithBlocks(hashes []string) (map[string][]string, error)
 
 	// temporary node register
 	BindRegisterInfo(secret, deviceID string, nodeType api.NodeType) error
@@ -725,6 +725,106 @@ func (sd sqlDB) UpdateCacheInfoOfQuitNode(deviceID string) (successCacheCount in
 	return
 }
 
+// UpdateCacheInfoOfCorruptedBlocks mark the blocks of device as restore, and the caches of blocks need to be restored
+func (sd sqlDB) UpdateCacheInfoOfCorruptedBlocks(deviceID string, hashes []string) (carfileReliabilitys map[string]int, err error) {
+	carfileReliabilitys = make(map[string]int)
+
+	area := sd.ReplaceArea()
+	bTableName := fmt.Sprintf(blockInfoTable, area)
+	cTableName := fmt.Sprintf(cacheInfoTable, area)
+	dTableName := fmt.Sprintf(dataInfoTable, area)
+
+	getCachesCmd := fmt.Sprintf("select * from (select cache_id from %s where device_id=? AND status=? AND cid_hash in (?) GROUP BY cache_id )as a LEFT JOIN %s as b on a.cache_id = b.cache_id  where status=?", bTableName, cTableName)
+	query, args, err := sqlx.In(getCachesCmd, deviceID, int(api.CacheStatusSuccess), hashes, int(api.CacheStatusSuccess))
+	if err != nil {
+		return
+	}
+
+	var caches []*api.CacheInfo
+	if err = sd.cli.Select(&caches, sd.cli.Rebind(query), args...); err != nil {
+		return
+	}
+
+	if len(caches) <= 0 {
+		err = xerrors.New(errNotFind)
+		return
+	}
+
+	cacheIDs := make([]string, 0)
+	for _, cache := range caches {
+		cacheIDs = append(cacheIDs, cache.CacheID)
+
+		carfileReliabilitys[cache.CarfileHash] += cache.Reliability
+	}
+
+	tx, err := sd.cli.Beginx()
+	if err != nil {
+		return
+	}
+
+	updateCachesCmd := fmt.Sprintf(`UPDATE %s SET status=? WHERE cache_id in (?)`, cTableName)
+	query, args, err = sqlx.In(updateCachesCmd, int(api.CacheStatusRestore), cacheIDs)
+	if err != nil {
+		tx.Rollback() //nolint:errcheck
+		return
+	}
+
+	// cache info
+	if _, err = tx.Exec(sd.cli.Rebind(query), args...); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return
+	}
+
+	// block info
+	updateBlocksCmd := fmt.Sprintf(`UPDATE %s SET status=? WHERE device_id=? AND status=? AND cid_hash in (?)`, bTableName)
+	query, args, err = sqlx.In(updateBlocksCmd, int(api.CacheStatusRestore), deviceID, int(api.CacheStatusSuccess), hashes)
+	if err != nil {
+		tx.Rollback() //nolint:errcheck
+		return
+	}
+
+	if _, err = tx.Exec(sd.cli.Rebind(query), args...); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return
+	}
+
+	// data info
+	for carfileHash, reliability := range carfileReliabilitys {
+		cmdD := fmt.Sprintf(`UPDATE %s SET reliability=reliability-? WHERE carfile_hash=?`, dTableName)
+		if _, err = tx.Exec(cmdD, reliability, carfileHash); err != nil {
+			tx.Rollback() //nolint:errcheck
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback() //nolint:errcheck
+		return
+	}
+
+	return
+}
+
+// RemoveBlocksOfDevice remove the block records of device, return the count of removed records
+func (sd sqlDB) RemoveBlocksOfDevice(deviceID string, hashes []string) (int64, error) {
+	area := sd.ReplaceArea()
+	bTableName := fmt.Sprintf(blockInfoTable, area)
+
+	removeBlocksCmd := fmt.Sprintf(`DELETE FROM %s WHERE device_id=? AND cid_hash in (?)`, bTableName)
+	query, args, err := sqlx.In(removeBlocksCmd, deviceID, hashes)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := sd.cli.Exec(sd.cli.Rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
 func (sd sqlDB) GetBlocksFID(deviceID string) (map[int]string, error) {
 	area := sd.ReplaceArea()
 
@@ -836,6 +936,36 @@ func (sd sqlDB) GetNodesWithBlock(hash string, isSuccess bool) ([]string, error)
 	return out, nil
 }
 
+// GetNodesWithBlocks return the devices which cached the blocks successfully, key is hash of block
+func (sd sqlDB) GetNodesWithBlocks(hashes []string) (map[string][]string, error) {
+	out := make(map[string][]string)
+	if len(hashes) == 0 {
+		return out, nil
+	}
+
+	area := sd.ReplaceArea()
+
+	cmd := fmt.Sprintf(`SELECT cid_hash,device_id FROM %s WHERE status=? AND cid_hash in (?)`, fmt.Sprintf(blockInfoTable, area))
+	query, args, err := sqlx.In(cmd, int(api.CacheStatusSuccess), hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		CIDHash  string `db:"cid_hash"`
+		DeviceID string `db:"device_id"`
+	}
+	if err := sd.cli.Select(&rows, sd.cli.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		out[row.CIDHash] = append(out[row.CIDHash], row.DeviceID)
+	}
+
+	return out, nil
+}
+
 // temporary node register
 func (sd sqlDB) BindRegisterInfo(secret, deviceID string, nodeType api.NodeType) error {
 	info := api.NodeRegisterInfo{
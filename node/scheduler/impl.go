@@ -50,6 +50,8 @@ const (
 	StatusOnline = "online"
 	// seconds
 	blockDonwloadTimeout = 30 * 60
+	// event of node reconcile block store
+	eventTypeNodeReconcile = "Node_Reconcile"
 )
 
 type blockDownloadVerifyStatus int
@@ -408,6 +410,39 @@ func (s *Scheduler) GetOnlineDeviceIDs(ctx context.Context, nodeType api.NodeTyp
 	return s.nodeManager.GetNodes(nodeType)
 }
 
+// NodeReconcileResult node report the blocks repaired by reconcile
+func (s *Scheduler) NodeReconcileResult(ctx context.Context, report api.ReconcileReport) error {
+	deviceID := handler.GetDeviceID(ctx)
+
+	if !isDeviceExists(deviceID, 0) {
+		return xerrors.Errorf("node not Exist: %s", deviceID)
+	}
+
+	msg := fmt.Sprintf("fid %d, block %d, orphan %d, missing %d, fixed keys %d",
+		report.FidCount, report.BlockCount, report.OrphanBlocks, report.MissingBlocks, report.FixedKeys)
+	log.Infof("NodeReconcileResult, device %s %s", deviceID, msg)
+
+	return persistent.GetDB().SetEventInfo(&api.EventInfo{DeviceID: deviceID, Msg: msg, Event: eventTypeNodeReconcile})
+}
+
+// NodeDownloadSrvCertFingerprint node register fingerprint of self-signed certificate of download server,
+// it is given to user with download info
+func (s *Scheduler) NodeDownloadSrvCertFingerprint(ctx context.Context, fingerprint string) error {
+	deviceID := handler.GetDeviceID(ctx)
+
+	if edge := s.nodeManager.GetEdgeNode(deviceID); edge != nil {
+		edge.SetDownloadSrvCertFingerprint(fingerprint)
+		return nil
+	}
+
+	if candidate := s.nodeManager.GetCandidateNode(deviceID); candidate != nil {
+		candidate.SetDownloadSrvCertFingerprint(fingerprint)
+		return nil
+	}
+
+	return xerrors.Errorf("node not online: %s", deviceID)
+}
+
 // GetCandidateDownloadInfoWithBlocks find node
 func (s *Scheduler) GetCandidateDownloadInfoWithBlocks(ctx context.Context, cids []string) (map[string]api.CandidateDownloadInfo, error) {
 	//TODO too much cid
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/helper"
 	titanRsa "github.com/linguohua/titan/node/rsa"
 	"github.com/linguohua/titan/node/scheduler/db/cache"
 	"github.com/linguohua/titan/node/scheduler/db/persistent"
@@ -112,6 +113,8 @@ type Node struct {
 	privateKey     *rsa.PrivateKey
 	nodeType       api.NodeTypeName
 	downloadSrvURL string
+	// fingerprint of self-signed certificate of download server
+	downloadSrvCertFingerprint string
 
 	geoInfo         *region.GeoInfo
 	lastRequestTime time.Time
@@ -150,6 +153,21 @@ func (n *Node) GetAddress() string {
 	return n.addr
 }
 
+// GetDownloadSrvURL get url of download server
+func (n *Node) GetDownloadSrvURL() string {
+	return n.downloadSrvURL
+}
+
+// GetDownloadSrvCertFingerprint get fingerprint of self-signed certificate of download server
+func (n *Node) GetDownloadSrvCertFingerprint() string {
+	return n.downloadSrvCertFingerprint
+}
+
+// SetDownloadSrvCertFingerprint set fingerprint of self-signed certificate of download server
+func (n *Node) SetDownloadSrvCertFingerprint(fingerprint string) {
+	n.downloadSrvCertFingerprint = fingerprint
+}
+
 // GetCacheTimeoutTimeStamp get cache timeout stamp
 func (n *Node) GetCacheTimeoutTimeStamp() int64 {
 	return n.cacheTimeoutTimeStamp
@@ -218,11 +236,17 @@ func (n *Node) UpdateCacheStat(info *api.CacheStat) {
 	n.cacheStat = info
 
 	num := info.WaitCacheBlockNum + info.DoingCacheBlockNum
+	// every block is tried BlockDownloadRetryNum + 1 times at most, RetryNum tries were done by the loading blocks
+	tries := helper.BlockDownloadRetryNum + 1
+	leftTries := num*tries - info.RetryNum
+	if leftTries < num {
+		leftTries = num
+	}
 
 	timeStamp := time.Now().Unix()
-	n.cacheTimeoutTimeStamp = timeStamp + int64(num*info.DownloadTimeout*info.RetryNum)
+	n.cacheTimeoutTimeStamp = timeStamp + int64(leftTries*info.DownloadTimeout)
 
-	n.cacheNextTimeoutTimeStamp = n.cacheTimeoutTimeStamp + int64(info.DownloadTimeout*info.RetryNum)
+	n.cacheNextTimeoutTimeStamp = n.cacheTimeoutTimeStamp + int64(info.DownloadTimeout*tries)
 
 	n.DiskUsage = info.DiskUsage
 }
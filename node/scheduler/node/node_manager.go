@@ -349,6 +349,19 @@ func (m *Manager) UpdateLastRequestTime(deviceID string) {
 	}
 }
 
+// return fingerprint of self-signed certificate of online node
+func (m *Manager) getDownloadSrvCertFingerprint(deviceID string) string {
+	if edge := m.GetEdgeNode(deviceID); edge != nil {
+		return edge.GetDownloadSrvCertFingerprint()
+	}
+
+	if candidate := m.GetCandidateNode(deviceID); candidate != nil {
+		return candidate.GetDownloadSrvCertFingerprint()
+	}
+
+	return ""
+}
+
 // FindNodeDownloadInfos  find device with block cid
 func (m *Manager) FindNodeDownloadInfos(cid string) ([]api.DownloadInfoResult, error) {
 	infos := make([]api.DownloadInfoResult, 0)
@@ -368,12 +381,12 @@ func (m *Manager) FindNodeDownloadInfos(cid string) ([]api.DownloadInfoResult, e
 	}
 
 	for _, deviceID := range deviceIDs {
-		info, err := persistent.GetDB().GetNodeAuthInfo(deviceID)
+		info, err := m.GetNodeDownloadInfo(deviceID)
 		if err != nil {
 			continue
 		}
 
-		infos = append(infos, api.DownloadInfoResult{URL: info.URL, DeviceID: deviceID})
+		infos = append(infos, info)
 	}
 
 	if len(infos) <= 0 {
@@ -383,6 +396,16 @@ func (m *Manager) FindNodeDownloadInfos(cid string) ([]api.DownloadInfoResult, e
 	return infos, nil
 }
 
+// GetNodeDownloadInfo return the download server of node, it is not signed
+func (m *Manager) GetNodeDownloadInfo(deviceID string) (api.DownloadInfoResult, error) {
+	info, err := persistent.GetDB().GetNodeAuthInfo(deviceID)
+	if err != nil {
+		return api.DownloadInfoResult{}, err
+	}
+
+	return api.DownloadInfoResult{URL: info.URL, DeviceID: deviceID, CertFingerprint: m.getDownloadSrvCertFingerprint(deviceID)}, nil
+}
+
 // GetCandidatesWithBlockHash find candidates with block hash
 func (m *Manager) GetCandidatesWithBlockHash(hash, filterHash string) ([]*CandidateNode, error) {
 	deviceIDs, err := persistent.GetDB().GetNodesWithBlock(hash, true)
@@ -5,6 +5,8 @@ import (
 	"crypto/rsa"
 	"encoding/hex"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -37,6 +39,12 @@ func (s *Scheduler) NodeResultForUserDownloadBlock(ctx context.Context, result a
 		return err
 	}
 
+	// result of sn was reported by the first request, replayed request does not change it
+	if !result.Result && strings.HasPrefix(result.FailedReason, api.DownloadFailedSnReplayed) && record.NodeStatus != int(blockDownloadStatusUnknow) {
+		log.Infof("NodeDownloadBlockResult, device %s sn %d replayed", deviceID, result.SN)
+		return nil
+	}
+
 	record.NodeStatus = int(blockDownloadStatusFailed)
 	if result.Result {
 		record.NodeStatus = int(blockDownloadStatusSuccess)
@@ -53,7 +61,7 @@ func (s *Scheduler) handleUserDownloadBlockResult(ctx context.Context, result ap
 		return err
 	}
 
-	err = s.verifyUserDownloadBlockSign(record.UserPublicKey, record.Cid, result.Sign)
+	err = s.verifyUserDownloadBlockSign(record.UserPublicKey, recordSignCid(record), result.Sign)
 	if err != nil {
 		log.Errorf("handleUserDownloadBlockResult, verifyNodeDownloadBlockSign error:%s", err.Error())
 		return err
@@ -200,8 +208,180 @@ func (s *Scheduler) GetDownloadInfoWithBlock(ctx context.Context, cid string, pu
 	return info, nil
 }
 
+// GetDownloadInfoWithCarfile find node holding the carfile, the sign is scoped to download the whole DAG of carfile
+func (s *Scheduler) GetDownloadInfoWithCarfile(ctx context.Context, cid string, publicKey string) (api.DownloadInfoResult, error) {
+	info, err := s.getScopedDownloadInfo(ctx, cid, publicKey, helper.CarfileSignContent(cid))
+	if err != nil {
+		return api.DownloadInfoResult{}, err
+	}
+
+	info.URL = strings.TrimSuffix(info.URL, helper.DownloadSrvPath) + helper.DownloadCarfileSrvPath
+	return info, nil
+}
+
+// GetDownloadInfoWithGateway find node holding the root, the sign is scoped to download the paths under root with gateway
+func (s *Scheduler) GetDownloadInfoWithGateway(ctx context.Context, cid string, publicKey string) (api.DownloadInfoResult, error) {
+	info, err := s.getScopedDownloadInfo(ctx, cid, publicKey, helper.GatewaySignContent(cid))
+	if err != nil {
+		return api.DownloadInfoResult{}, err
+	}
+
+	info.URL = strings.TrimSuffix(info.URL, helper.DownloadSrvPath) + helper.DownloadGatewaySrvPath + cid
+	return info, nil
+}
+
+// getScopedDownloadInfo find node holding cid and sign content instead of cid, the content is recorded as manifest
+func (s *Scheduler) getScopedDownloadInfo(ctx context.Context, cid, publicKey, content string) (api.DownloadInfoResult, error) {
+	if cid == "" {
+		return api.DownloadInfoResult{}, xerrors.New("cid is nil")
+	}
+
+	infos, err := s.nodeManager.FindNodeDownloadInfos(cid)
+	if err != nil {
+		return api.DownloadInfoResult{}, err
+	}
+
+	infos = []api.DownloadInfoResult{infos[randomNum(0, len(infos))]}
+	err = s.signDownloadInfos(content, infos, make(map[string]*rsa.PrivateKey))
+	if err != nil {
+		return api.DownloadInfoResult{}, err
+	}
+
+	info := infos[0]
+
+	record := &cache.DownloadBlockRecord{
+		SN:            info.SN,
+		ID:            uuid.New().String(),
+		Cid:           cid,
+		SignTime:      info.SignTime,
+		Timeout:       blockDonwloadTimeout,
+		UserPublicKey: publicKey,
+		NodeStatus:    int(blockDownloadStatusUnknow),
+		UserStatus:    int(blockDownloadStatusUnknow),
+		Manifest:      content,
+	}
+
+	err = s.recordDownloadBlock(record, nil, "", handler.GetRequestIP(ctx))
+	if err != nil {
+		log.Errorf("getScopedDownloadInfo,recordDownloadBlock error %s", err.Error())
+	}
+
+	return info, nil
+}
+
+// GetBatchDownloadInfo find the node holding most of blocks, return the cids it holds and the sign of manifest
+func (s *Scheduler) GetBatchDownloadInfo(ctx context.Context, cids []string, publicKey string) (api.BatchDownloadInfoResult, error) {
+	if len(cids) < 1 {
+		return api.BatchDownloadInfoResult{}, xerrors.New("cids is nil")
+	}
+
+	if len(cids) > helper.BatchDownloadMaxBlocks {
+		return api.BatchDownloadInfoResult{}, xerrors.Errorf("cids %d more than %d", len(cids), helper.BatchDownloadMaxBlocks)
+	}
+
+	// the nodes of all blocks are found with one query
+	cidHashes := make(map[string]string)
+	hashes := make([]string, 0, len(cids))
+	for _, cid := range cids {
+		hash, err := helper.CIDString2HashString(cid)
+		if err != nil {
+			continue
+		}
+
+		if _, exist := cidHashes[cid]; !exist {
+			hashes = append(hashes, hash)
+		}
+		cidHashes[cid] = hash
+	}
+
+	hashNodes, err := persistent.GetDB().GetNodesWithBlocks(hashes)
+	if err != nil {
+		return api.BatchDownloadInfoResult{}, err
+	}
+
+	// device => cids held by device
+	deviceCids := make(map[string][]string)
+	for _, cid := range cids {
+		hash, exist := cidHashes[cid]
+		if !exist {
+			continue
+		}
+
+		for _, deviceID := range hashNodes[hash] {
+			deviceCids[deviceID] = append(deviceCids[deviceID], cid)
+		}
+	}
+
+	// the device holding most of blocks first
+	deviceIDs := make([]string, 0, len(deviceCids))
+	for deviceID := range deviceCids {
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+	sort.Slice(deviceIDs, func(i, j int) bool {
+		if len(deviceCids[deviceIDs[i]]) != len(deviceCids[deviceIDs[j]]) {
+			return len(deviceCids[deviceIDs[i]]) > len(deviceCids[deviceIDs[j]])
+		}
+		return deviceIDs[i] < deviceIDs[j]
+	})
+
+	deviceID := ""
+	var infos []api.DownloadInfoResult
+	for _, id := range deviceIDs {
+		info, err := s.nodeManager.GetNodeDownloadInfo(id)
+		if err != nil {
+			continue
+		}
+
+		deviceID = id
+		infos = []api.DownloadInfoResult{info}
+		break
+	}
+
+	if deviceID == "" {
+		return api.BatchDownloadInfoResult{}, xerrors.Errorf("not found node with cids")
+	}
+
+	manifest := helper.BatchManifestHash(deviceCids[deviceID])
+	err = s.signDownloadInfos(manifest, infos, make(map[string]*rsa.PrivateKey))
+	if err != nil {
+		return api.BatchDownloadInfoResult{}, err
+	}
+
+	info := infos[0]
+	info.URL = strings.TrimSuffix(info.URL, helper.DownloadSrvPath) + helper.DownloadBatchSrvPath
+
+	// one record for all blocks, the first cid is recorded as the block downloaded
+	record := &cache.DownloadBlockRecord{
+		SN:            info.SN,
+		ID:            uuid.New().String(),
+		Cid:           deviceCids[deviceID][0],
+		SignTime:      info.SignTime,
+		Timeout:       blockDonwloadTimeout,
+		UserPublicKey: publicKey,
+		NodeStatus:    int(blockDownloadStatusUnknow),
+		UserStatus:    int(blockDownloadStatusUnknow),
+		Manifest:      manifest,
+	}
+
+	err = s.recordDownloadBlock(record, nil, "", handler.GetRequestIP(ctx))
+	if err != nil {
+		log.Errorf("GetBatchDownloadInfo,recordDownloadBlock error %s", err.Error())
+	}
+
+	return api.BatchDownloadInfoResult{DownloadInfoResult: info, Cids: deviceCids[deviceID]}, nil
+}
+
+// recordSignCid return the content signed instead of cid, it is manifest hash for batch download and carfile sign content for carfile download
+func recordSignCid(record *cache.DownloadBlockRecord) string {
+	if record.Manifest != "" {
+		return record.Manifest
+	}
+
+	return record.Cid
+}
+
 func (s *Scheduler) verifyNodeResultForUserDownloadBlock(deviceID string, record *cache.DownloadBlockRecord, sign []byte) error {
-	verifyContent := fmt.Sprintf("%s%d%d%d", record.Cid, record.SN, record.SignTime, record.Timeout)
+	verifyContent := fmt.Sprintf("%s%d%d%d", recordSignCid(record), record.SN, record.SignTime, record.Timeout)
 	edgeNode := s.nodeManager.GetEdgeNode(deviceID)
 	if edgeNode != nil {
 		return titanRsa.VerifyRsaSign(&edgeNode.GetPrivateKey().PublicKey, sign, verifyContent)
@@ -330,6 +510,11 @@ func (s *Scheduler) recordDownloadBlock(record *cache.DownloadBlockRecord, nodeR
 	if nodeResult != nil {
 		info.Speed = int64(nodeResult.DownloadSpeed)
 		info.FailedReason = nodeResult.FailedReason
+
+		// scoped sign download more than the recorded block, the bytes sent by node are recorded
+		if record.Manifest != "" && nodeResult.BlockSize > 0 {
+			info.BlockSize = nodeResult.BlockSize
+		}
 	}
 
 	if len(deviceID) > 0 {
@@ -116,7 +116,7 @@ func (w *web) GetCacheBlockInfos(ctx context.Context, req api.ListCacheBlocksReq
 
 // cache manager
 func (w *web) AddCacheTask(ctx context.Context, carFileCID string, reliability int, expireTime time.Time) error {
-	return w.scheduler.CacheCarfile(ctx, carFileCID, reliability, expireTime)
+	return w.scheduler.CacheCarfile(ctx, carFileCID, reliability, 0, expireTime)
 }
 
 func (w *web) ListCacheTasks(ctx context.Context, cursor int, count int) (api.ListCacheTasksRsp, error) {
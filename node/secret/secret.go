@@ -19,6 +19,9 @@ import (
 const (
 	JWTSecretName   = "auth-jwt-private" //nolint:gosec
 	KTJwtHmacSecret = "jwt-hmac-secret"  //nolint:gosec
+
+	BlockStoreKeyName = "blockstore-key" //nolint:gosec
+	KTBlockStoreAES   = "blockstore-aes" //nolint:gosec
 )
 
 type JwtPayload struct {
@@ -71,3 +74,34 @@ func APISecret(lr repo.LockedRepo) (*jwt.HMACSHA, error) {
 
 	return jwt.NewHS256(key.PrivateKey), nil
 }
+
+// BlockStoreKey return the key to encrypt block store, generate a new one if not exist
+func BlockStoreKey(lr repo.LockedRepo) ([]byte, error) {
+	keystore, err := lr.KeyStore()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := keystore.Get(BlockStoreKeyName)
+	if errors.Is(err, types.ErrKeyInfoNotFound) {
+		log.Warn("Generating new block store key")
+
+		sk, err := ioutil.ReadAll(io.LimitReader(rand.Reader, 32))
+		if err != nil {
+			return nil, err
+		}
+
+		key = types.KeyInfo{
+			Type:       KTBlockStoreAES,
+			PrivateKey: sk,
+		}
+
+		if err := keystore.Put(BlockStoreKeyName, key); err != nil {
+			return nil, xerrors.Errorf("writing block store key: %w", err)
+		}
+	} else if err != nil {
+		return nil, xerrors.Errorf("could not get block store key: %w", err)
+	}
+
+	return key.PrivateKey, nil
+}
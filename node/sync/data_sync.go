@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"sync"
 
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/query"
@@ -15,17 +16,35 @@ import (
 	"github.com/linguohua/titan/blockstore"
 	"github.com/linguohua/titan/node/block"
 	"github.com/linguohua/titan/node/helper"
+	"golang.org/x/time/rate"
 )
 
 var log = logging.Logger("datasync")
 
 type DataSync struct {
-	block *block.Block
-	ds    datastore.Batching
+	block      *block.Block
+	ds         datastore.Batching
+	blockStore blockstore.BlockStore
+	scheduler  api.Scheduler
+
+	reconcileLimiter *rate.Limiter
+	reconcileLock    *sync.Mutex
+	reconciling      bool
 }
 
-func NewDataSync(block *block.Block, ds datastore.Batching) *DataSync {
-	return &DataSync{block: block, ds: ds}
+func NewDataSync(block *block.Block, params *helper.NodeParams) *DataSync {
+	dataSync := &DataSync{
+		block:            block,
+		ds:               params.DS,
+		blockStore:       params.BlockStore,
+		scheduler:        params.Scheduler,
+		reconcileLimiter: newReconcileLimiter(params.ReconcileRate),
+		reconcileLock:    &sync.Mutex{},
+	}
+
+	go dataSync.startReconciler(params.ReconcileInterval)
+
+	return dataSync
 }
 
 func (dataSync *DataSync) GetAllChecksums(ctx context.Context, maxGroupNum int) (api.ChecksumRsp, error) {
@@ -268,118 +287,3 @@ func string2Hash(value string) string {
 	hash := hasher.Sum(nil)
 	return hex.EncodeToString(hash)
 }
-
-func SyncLocalBlockstore(ds datastore.Batching, blockstore blockstore.BlockStore, block *block.Block) error {
-	log.Info("start sync local block store")
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	fidQuery := query.Query{Prefix: "fid"}
-	results, err := ds.Query(ctx, fidQuery)
-	if err != nil {
-		log.Errorf("getCheckSums datastore query error:%s", err.Error())
-		return err
-	}
-	// key hash, value fid
-	targetMap := make(map[string]string)
-
-	for {
-		r, exist := results.NextSync()
-		if !exist {
-			break
-		}
-
-		fidStr := r.Key[len(helper.KeyFidPrefix)+1:]
-		hash := string(r.Value)
-		targetMap[hash] = fidStr
-	}
-
-	log.Info("start sync fid and cid")
-
-	hashQuery := query.Query{Prefix: "hash"}
-	results, err = ds.Query(ctx, hashQuery)
-	if err != nil {
-		log.Errorf("getCheckSums datastore query error:%s", err.Error())
-		return err
-	}
-
-	hashMap := make(map[string]string)
-
-	for {
-		r, exist := results.NextSync()
-		if !exist {
-			break
-		}
-
-		hash := r.Key[len(helper.KeyCidPrefix)+1:]
-		hashMap[hash] = string(r.Value)
-	}
-
-	for targetHash, targetFid := range targetMap {
-		fid, exist := hashMap[targetHash]
-		if exist {
-			delete(hashMap, targetHash)
-			if fid == targetFid {
-				continue
-			}
-
-		}
-
-		ds.Put(ctx, helper.NewKeyHash(targetHash), []byte(targetFid))
-
-		log.Warnf("hash:fid %s ==> %s not match in target fid:hash %s ==> %s ", targetHash, fid, targetFid, targetHash)
-	}
-
-	for hash, fid := range hashMap {
-		ds.Delete(ctx, helper.NewKeyHash(hash))
-		log.Warnf("hash:fid %s ==> %s not in fid map, was delete", hash, fid)
-	}
-
-	hashs, err := blockstore.GetAllKeys()
-	if err != nil {
-		return err
-	}
-
-	log.Info("start sync block")
-	need2DeleteBlockHashs := make([]string, 0)
-	for _, hash := range hashs {
-		_, exist := targetMap[hash]
-		if !exist {
-			need2DeleteBlockHashs = append(need2DeleteBlockHashs, hash)
-		} else {
-			delete(targetMap, hash)
-		}
-
-	}
-
-	need2DeleteBlockCids := make([]string, 0)
-	for _, hash := range need2DeleteBlockHashs {
-		cid, err := helper.HashString2CidString(hash)
-		if err != nil {
-			continue
-		}
-
-		need2DeleteBlockCids = append(need2DeleteBlockCids, cid)
-	}
-
-	block.DeleteBlocks(context.Background(), need2DeleteBlockCids)
-
-	blocksCIDMap := make(map[int]string)
-	for hash, fidStr := range targetMap {
-		fid, err := strconv.Atoi(fidStr)
-		if err != nil {
-			continue
-		}
-		cid, err := helper.HashString2CidString(hash)
-		if err != nil {
-			continue
-		}
-		blocksCIDMap[fid] = cid
-	}
-
-	block.SyncData(blocksCIDMap)
-
-	log.Infof("sync local block store complete, delete blocks %d, download blocks %d", len(need2DeleteBlockCids), len(blocksCIDMap))
-
-	return nil
-}
@@ -0,0 +1,209 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/linguohua/titan/blockstore"
+	mh "github.com/multiformats/go-multihash"
+)
+
+const (
+	migrateCheckpointKey = "migrate/checkpoint"
+	// save checkpoint after migrate every migrateCheckpointInterval blocks
+	migrateCheckpointInterval = 100
+)
+
+type MigrateStat struct {
+	Total    int
+	Migrated int
+	// block already migrated before resume
+	Skipped int
+	// fid exist but block not in source store
+	Missing int
+	Failed  int
+}
+
+type migrateCheckpoint struct {
+	// identify the target store, checkpoint of other target will be ignored
+	Target  string
+	LastKey string
+}
+
+// MigrateBlockStore copy all blocks that have fid from source store to target store,
+// the relation of fid and block hash in datastore is not changed.
+// Migration can be resumed from the checkpoint saved in datastore
+func MigrateBlockStore(ctx context.Context, ds datastore.Batching, from, to blockstore.BlockStore, progress func(stat MigrateStat)) (MigrateStat, error) {
+	stat := MigrateStat{}
+
+	total, err := countFids(ctx, ds)
+	if err != nil {
+		return stat, err
+	}
+	stat.Total = total
+
+	checkpoint := loadMigrateCheckpoint(ctx, ds, to.GetPath())
+	if len(checkpoint.LastKey) > 0 {
+		log.Infof("resume migrate from %s", checkpoint.LastKey)
+	}
+
+	results, err := ds.Query(ctx, query.Query{Prefix: "fid", Orders: []query.Order{query.OrderByKey{}}})
+	if err != nil {
+		return stat, err
+	}
+	defer results.Close() //nolint:errcheck
+
+	for {
+		r, exist := results.NextSync()
+		if !exist {
+			break
+		}
+
+		if r.Error != nil {
+			return stat, r.Error
+		}
+
+		if r.Key <= checkpoint.LastKey {
+			stat.Skipped++
+			continue
+		}
+
+		hash := string(r.Value)
+		err = migrateBlock(from, to, hash)
+		switch {
+		case err == datastore.ErrNotFound:
+			stat.Missing++
+			log.Warnf("migrate block %s, fid key %s, block not exist", hash, r.Key)
+		case err != nil:
+			stat.Failed++
+			log.Errorf("migrate block %s error:%s", hash, err.Error())
+		default:
+			stat.Migrated++
+		}
+
+		// checkpoint stop at the first failed block, so resume will retry it
+		if stat.Failed == 0 {
+			checkpoint.LastKey = r.Key
+		}
+		if (stat.Migrated+stat.Missing+stat.Failed)%migrateCheckpointInterval == 0 {
+			saveMigrateCheckpoint(ctx, ds, checkpoint)
+			if progress != nil {
+				progress(stat)
+			}
+		}
+
+		if ctx.Err() != nil {
+			saveMigrateCheckpoint(ctx, ds, checkpoint)
+			return stat, ctx.Err()
+		}
+	}
+
+	if progress != nil {
+		progress(stat)
+	}
+
+	if stat.Failed > 0 {
+		// keep checkpoint, resume from the first failed block
+		saveMigrateCheckpoint(ctx, ds, checkpoint)
+		return stat, fmt.Errorf("migrate %d blocks failed", stat.Failed)
+	}
+
+	err = ds.Delete(ctx, datastore.NewKey(migrateCheckpointKey))
+	if err != nil && err != datastore.ErrNotFound {
+		return stat, err
+	}
+
+	return stat, nil
+}
+
+// copy block and check it with hash after read back from target store
+func migrateBlock(from, to blockstore.BlockStore, hash string) error {
+	data, err := from.Get(hash)
+	if err != nil {
+		return err
+	}
+
+	err = to.Put(hash, data)
+	if err != nil {
+		return err
+	}
+
+	copied, err := to.Get(hash)
+	if err != nil {
+		return err
+	}
+
+	multihash, err := mh.FromHexString(hash)
+	if err != nil {
+		return err
+	}
+
+	decoded, err := mh.Decode(multihash)
+	if err != nil {
+		return err
+	}
+
+	sum, err := mh.Sum(copied, decoded.Code, decoded.Length)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(sum, multihash) {
+		return fmt.Errorf("block %s verify failed after copy", hash)
+	}
+
+	return nil
+}
+
+func countFids(ctx context.Context, ds datastore.Batching) (int, error) {
+	results, err := ds.Query(ctx, query.Query{Prefix: "fid", KeysOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	defer results.Close() //nolint:errcheck
+
+	count := 0
+	for {
+		_, exist := results.NextSync()
+		if !exist {
+			break
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+func loadMigrateCheckpoint(ctx context.Context, ds datastore.Batching, target string) migrateCheckpoint {
+	checkpoint := migrateCheckpoint{Target: target}
+
+	value, err := ds.Get(ctx, datastore.NewKey(migrateCheckpointKey))
+	if err != nil {
+		return checkpoint
+	}
+
+	saved := migrateCheckpoint{}
+	err = json.Unmarshal(value, &saved)
+	if err != nil || saved.Target != target {
+		return checkpoint
+	}
+
+	return saved
+}
+
+func saveMigrateCheckpoint(ctx context.Context, ds datastore.Batching, checkpoint migrateCheckpoint) {
+	value, err := json.Marshal(checkpoint)
+	if err != nil {
+		log.Errorf("saveMigrateCheckpoint marshal error:%s", err.Error())
+		return
+	}
+
+	err = ds.Put(ctx, datastore.NewKey(migrateCheckpointKey), value)
+	if err != nil {
+		log.Errorf("saveMigrateCheckpoint error:%s", err.Error())
+	}
+}
@@ -0,0 +1,67 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/linguohua/titan/blockstore"
+	"github.com/linguohua/titan/node/helper"
+)
+
+// failStore fail to put the block in fails
+type failStore struct {
+	blockstore.BlockStore
+	fails map[string]bool
+}
+
+func (fs *failStore) Put(key string, value []byte) error {
+	if fs.fails[key] {
+		return fmt.Errorf("put block %s failed", key)
+	}
+	return fs.BlockStore.Put(key, value)
+}
+
+func TestMigrateResumeFailed(t *testing.T) {
+	ctx := context.Background()
+
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	from := blockstore.NewBlockStore(t.TempDir(), "FileStore")
+	to := &failStore{BlockStore: blockstore.NewBlockStore(t.TempDir(), "FileStore"), fails: make(map[string]bool)}
+
+	hashes := make([]string, 0)
+	for i := 1; i <= 3; i++ {
+		b := blocks.NewBlock([]byte(fmt.Sprintf("titan block %d", i)))
+		hash := b.Cid().Hash().String()
+		if err := from.Put(hash, b.RawData()); err != nil {
+			t.Fatal(err)
+		}
+		if err := ds.Put(ctx, helper.NewKeyFID(fmt.Sprintf("%d", i)), []byte(hash)); err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	// the second block failed
+	to.fails[hashes[1]] = true
+	stat, err := MigrateBlockStore(ctx, ds, from, to, nil)
+	if err == nil || stat.Migrated != 2 || stat.Failed != 1 {
+		t.Fatalf("migrate stat %+v, error %v, expect 1 block failed", stat, err)
+	}
+
+	// resume retry the failed block
+	to.fails[hashes[1]] = false
+	stat, err = MigrateBlockStore(ctx, ds, from, to, nil)
+	if err != nil || stat.Failed != 0 || stat.Skipped != 1 || stat.Migrated != 2 {
+		t.Fatalf("resume migrate stat %+v, error %v", stat, err)
+	}
+
+	for _, hash := range hashes {
+		if exist, _ := to.Has(hash); !exist {
+			t.Fatalf("block %s not migrated", hash)
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/helper"
+	"golang.org/x/time/rate"
+)
+
+const (
+	reconcileCheckpointKey = "reconcile/checkpoint"
+	// save checkpoint every reconcileCheckpointInterval keys
+	reconcileCheckpointInterval = 1000
+	// refetch missing blocks in batch
+	reconcileRefetchBatch = 1000
+	// max number of cids in report
+	reconcileReportMaxCids = 1000
+)
+
+const (
+	// check every fid has hash relation
+	reconcilePhaseFid = iota
+	// check every hash relation has fid
+	reconcilePhaseHash
+	// merge hash relations and blocks in block store
+	reconcilePhaseBlock
+)
+
+type reconcileCheckpoint struct {
+	Phase int
+	// last key of datastore was checked, it is the last hash in block phase
+	LastKey string
+}
+
+// Reconcile check the block store and the relation of fid and hash,
+// remove orphan blocks and refetch missing blocks.
+// The relations of fid and hash are checked by each other in datastore, then the hash relations
+// and the keys of block store are streamed in hash order and merged, so memory usage is bounded
+func (dataSync *DataSync) Reconcile(ctx context.Context, dryRun bool) (api.ReconcileReport, error) {
+	dataSync.reconcileLock.Lock()
+	if dataSync.reconciling {
+		dataSync.reconcileLock.Unlock()
+		return api.ReconcileReport{}, fmt.Errorf("reconcile is running")
+	}
+	dataSync.reconciling = true
+	dataSync.reconcileLock.Unlock()
+
+	defer func() {
+		dataSync.reconcileLock.Lock()
+		dataSync.reconciling = false
+		dataSync.reconcileLock.Unlock()
+	}()
+
+	report := api.ReconcileReport{DryRun: dryRun, StartTime: time.Now(), OrphanCids: make([]string, 0), RefetchCids: make([]string, 0)}
+	err := dataSync.reconcile(ctx, &report)
+	report.EndTime = time.Now()
+	if err != nil {
+		log.Errorf("Reconcile error:%s", err.Error())
+		return report, err
+	}
+
+	log.Infof("Reconcile complete, dry run %v, fid %d, block %d, orphan %d, missing %d, fixed keys %d",
+		dryRun, report.FidCount, report.BlockCount, report.OrphanBlocks, report.MissingBlocks, report.FixedKeys)
+
+	if !dryRun && (report.OrphanBlocks > 0 || report.MissingBlocks > 0 || report.FixedKeys > 0) {
+		dataSync.reconcileResult(report)
+	}
+
+	return report, nil
+}
+
+// run reconcile once at start, then run it every interval, interval <= 0 means only run at start
+func (dataSync *DataSync) startReconciler(interval time.Duration) {
+	for {
+		_, err := dataSync.Reconcile(context.Background(), false)
+		if err != nil {
+			log.Errorf("startReconciler, reconcile error:%s", err.Error())
+		}
+
+		if interval <= 0 {
+			return
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+func (dataSync *DataSync) reconcile(ctx context.Context, report *api.ReconcileReport) error {
+	checkpoint := reconcileCheckpoint{}
+	if !report.DryRun {
+		checkpoint = dataSync.loadReconcileCheckpoint(ctx)
+	}
+
+	if checkpoint.Phase <= reconcilePhaseFid {
+		err := dataSync.reconcileQuery(ctx, report, helper.KeyFidPrefix, &checkpoint, func(key string, value []byte) error {
+			return dataSync.reconcileFid(ctx, report, key, string(value))
+		})
+		if err != nil {
+			return err
+		}
+
+		checkpoint = reconcileCheckpoint{Phase: reconcilePhaseHash}
+	}
+
+	if checkpoint.Phase <= reconcilePhaseHash {
+		err := dataSync.reconcileQuery(ctx, report, helper.KeyCidPrefix, &checkpoint, func(key string, value []byte) error {
+			return dataSync.reconcileHash(ctx, report, key, string(value))
+		})
+		if err != nil {
+			return err
+		}
+
+		checkpoint = reconcileCheckpoint{Phase: reconcilePhaseBlock}
+		dataSync.saveReconcileCheckpoint(ctx, report, checkpoint)
+	}
+
+	err := dataSync.reconcileBlocks(ctx, report, &checkpoint)
+	if err != nil {
+		dataSync.saveReconcileCheckpoint(context.Background(), report, checkpoint)
+		return err
+	}
+
+	if !report.DryRun {
+		err = dataSync.ds.Delete(ctx, datastore.NewKey(reconcileCheckpointKey))
+		if err != nil && err != datastore.ErrNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// iterate keys with prefix in order from checkpoint, checkpoint is saved periodically
+func (dataSync *DataSync) reconcileQuery(ctx context.Context, report *api.ReconcileReport, prefix string, checkpoint *reconcileCheckpoint, f func(key string, value []byte) error) error {
+	results, err := dataSync.ds.Query(ctx, query.Query{Prefix: prefix, Orders: []query.Order{query.OrderByKey{}}})
+	if err != nil {
+		return err
+	}
+	defer results.Close() //nolint:errcheck
+
+	count := 0
+	for {
+		r, exist := results.NextSync()
+		if !exist {
+			break
+		}
+
+		if r.Error != nil {
+			return r.Error
+		}
+
+		if r.Key <= checkpoint.LastKey {
+			continue
+		}
+
+		err = dataSync.reconcileLimiter.Wait(ctx)
+		if err != nil {
+			dataSync.saveReconcileCheckpoint(context.Background(), report, *checkpoint)
+			return err
+		}
+
+		err = f(r.Key, r.Value)
+		if err != nil {
+			dataSync.saveReconcileCheckpoint(context.Background(), report, *checkpoint)
+			return err
+		}
+
+		checkpoint.LastKey = r.Key
+
+		count++
+		if count%reconcileCheckpointInterval == 0 {
+			dataSync.saveReconcileCheckpoint(ctx, report, *checkpoint)
+		}
+	}
+
+	return nil
+}
+
+// fid must have the relation of hash to fid
+func (dataSync *DataSync) reconcileFid(ctx context.Context, report *api.ReconcileReport, key, hash string) error {
+	report.FidCount++
+	fid := key[len(helper.KeyFidPrefix)+1:]
+
+	value, err := dataSync.ds.Get(ctx, helper.NewKeyHash(hash))
+	if err != nil && err != datastore.ErrNotFound {
+		return err
+	}
+
+	if string(value) == fid {
+		return nil
+	}
+
+	report.FixedKeys++
+	log.Warnf("reconcile, hash %s relate fid %s, but fid %s relate hash %s", hash, string(value), fid, hash)
+
+	if report.DryRun {
+		return nil
+	}
+
+	return dataSync.ds.Put(ctx, helper.NewKeyHash(hash), []byte(fid))
+}
+
+// relation of hash to fid must be the same as fid to hash
+func (dataSync *DataSync) reconcileHash(ctx context.Context, report *api.ReconcileReport, key, fid string) error {
+	hash := key[len(helper.KeyCidPrefix)+1:]
+
+	value, err := dataSync.ds.Get(ctx, helper.NewKeyFID(fid))
+	if err != nil && err != datastore.ErrNotFound {
+		return err
+	}
+
+	if string(value) == hash {
+		return nil
+	}
+
+	report.FixedKeys++
+	log.Warnf("reconcile, hash %s relate fid %s, but fid relate hash %s", hash, fid, string(value))
+
+	if report.DryRun {
+		return nil
+	}
+
+	return dataSync.ds.Delete(ctx, datastore.NewKey(key))
+}
+
+// reconcileBlocks merge the hash relations in datastore and the keys of block store, both of them are in hash order.
+// Hash only in datastore is missing block and will be refetched, hash only in block store is orphan block and will be removed
+func (dataSync *DataSync) reconcileBlocks(ctx context.Context, report *api.ReconcileReport, checkpoint *reconcileCheckpoint) error {
+	results, err := dataSync.ds.Query(ctx, query.Query{Prefix: helper.KeyCidPrefix, Orders: []query.Order{query.OrderByKey{}}})
+	if err != nil {
+		return err
+	}
+	defer results.Close() //nolint:errcheck
+
+	refetchBlocks := make(map[int]string)
+	// refetch the rest of missing blocks even if error
+	defer dataSync.refetchBlocks(report, refetchBlocks)
+
+	// next hash relation in datastore, empty if no more
+	var nextHash, nextFid string
+	nextRelation := func() error {
+		for {
+			r, exist := results.NextSync()
+			if !exist {
+				nextHash = ""
+				return nil
+			}
+
+			if r.Error != nil {
+				return r.Error
+			}
+
+			nextHash, nextFid = r.Key[len(helper.KeyCidPrefix)+1:], string(r.Value)
+			if nextHash > checkpoint.LastKey {
+				return nil
+			}
+		}
+	}
+
+	count := 0
+	// hash was checked, save checkpoint periodically
+	checked := func(hash string) {
+		checkpoint.LastKey = hash
+
+		count++
+		if count%reconcileCheckpointInterval == 0 {
+			dataSync.saveReconcileCheckpoint(ctx, report, *checkpoint)
+		}
+	}
+
+	err = nextRelation()
+	if err != nil {
+		return err
+	}
+
+	err = dataSync.blockStore.ForEachKey(func(hash string) error {
+		if hash <= checkpoint.LastKey {
+			return nil
+		}
+
+		for nextHash != "" && nextHash < hash {
+			dataSync.reconcileMissingBlock(report, nextHash, nextFid, refetchBlocks)
+			checked(nextHash)
+
+			if err := nextRelation(); err != nil {
+				return err
+			}
+		}
+
+		err := dataSync.reconcileLimiter.Wait(ctx)
+		if err != nil {
+			return err
+		}
+
+		report.BlockCount++
+		if nextHash == hash {
+			checked(hash)
+			return nextRelation()
+		}
+
+		dataSync.reconcileOrphanBlock(report, hash)
+		checked(hash)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for nextHash != "" {
+		dataSync.reconcileMissingBlock(report, nextHash, nextFid, refetchBlocks)
+		checked(nextHash)
+
+		if err := nextRelation(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hash relation without block, the block will be refetched
+func (dataSync *DataSync) reconcileMissingBlock(report *api.ReconcileReport, hash, fid string, refetchBlocks map[int]string) {
+	// block may be saved after block store was iterated
+	if exist, _ := dataSync.blockStore.Has(hash); exist {
+		return
+	}
+
+	cid, err := helper.HashString2CidString(hash)
+	if err != nil {
+		log.Errorf("reconcileMissingBlock, HashString2CidString error:%s, hash:%s", err.Error(), hash)
+		return
+	}
+
+	fidInt, err := strconv.Atoi(fid)
+	if err != nil {
+		log.Errorf("reconcileMissingBlock, parse fid %s error:%s", fid, err.Error())
+		return
+	}
+
+	report.MissingBlocks++
+	if len(report.RefetchCids) < reconcileReportMaxCids {
+		report.RefetchCids = append(report.RefetchCids, cid)
+	}
+
+	refetchBlocks[fidInt] = cid
+	if len(refetchBlocks) >= reconcileRefetchBatch {
+		dataSync.refetchBlocks(report, refetchBlocks)
+	}
+}
+
+// block without hash relation, the block will be removed
+func (dataSync *DataSync) reconcileOrphanBlock(report *api.ReconcileReport, hash string) {
+	if !report.DryRun {
+		deleted, err := dataSync.block.DeleteOrphanBlock(hash)
+		if err != nil {
+			log.Errorf("reconcileOrphanBlock, delete orphan block %s error:%s", hash, err.Error())
+			return
+		}
+
+		// block is saving
+		if !deleted {
+			return
+		}
+	}
+
+	report.OrphanBlocks++
+	if len(report.OrphanCids) < reconcileReportMaxCids {
+		cid, err := helper.HashString2CidString(hash)
+		if err == nil {
+			report.OrphanCids = append(report.OrphanCids, cid)
+		}
+	}
+}
+
+func (dataSync *DataSync) refetchBlocks(report *api.ReconcileReport, blocks map[int]string) {
+	if len(blocks) == 0 {
+		return
+	}
+
+	if !report.DryRun {
+		err := dataSync.block.SyncData(blocks)
+		if err != nil {
+			log.Errorf("refetchBlocks, sync data error:%s", err.Error())
+		}
+	}
+
+	for fid := range blocks {
+		delete(blocks, fid)
+	}
+}
+
+func (dataSync *DataSync) reconcileResult(report api.ReconcileReport) {
+	ctx, cancel := context.WithTimeout(context.Background(), helper.SchedulerApiTimeout*time.Second)
+	defer cancel()
+
+	err := dataSync.scheduler.NodeReconcileResult(ctx, report)
+	if err != nil {
+		log.Errorf("reconcileResult error:%s", err.Error())
+	}
+}
+
+func (dataSync *DataSync) loadReconcileCheckpoint(ctx context.Context) reconcileCheckpoint {
+	checkpoint := reconcileCheckpoint{}
+
+	value, err := dataSync.ds.Get(ctx, datastore.NewKey(reconcileCheckpointKey))
+	if err != nil {
+		return checkpoint
+	}
+
+	err = json.Unmarshal(value, &checkpoint)
+	if err != nil {
+		log.Errorf("loadReconcileCheckpoint unmarshal error:%s", err.Error())
+		return reconcileCheckpoint{}
+	}
+
+	log.Infof("resume reconcile from phase %d, key %s", checkpoint.Phase, checkpoint.LastKey)
+	return checkpoint
+}
+
+// dry run will not save checkpoint
+func (dataSync *DataSync) saveReconcileCheckpoint(ctx context.Context, report *api.ReconcileReport, checkpoint reconcileCheckpoint) {
+	if report.DryRun {
+		return
+	}
+
+	value, err := json.Marshal(checkpoint)
+	if err != nil {
+		log.Errorf("saveReconcileCheckpoint marshal error:%s", err.Error())
+		return
+	}
+
+	err = dataSync.ds.Put(ctx, datastore.NewKey(reconcileCheckpointKey), value)
+	if err != nil {
+		log.Errorf("saveReconcileCheckpoint error:%s", err.Error())
+	}
+}
+
+func newReconcileLimiter(keysPerSecond int) *rate.Limiter {
+	if keysPerSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+
+	return rate.NewLimiter(rate.Limit(keysPerSecond), keysPerSecond)
+}
@@ -0,0 +1,121 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/blockstore"
+	"github.com/linguohua/titan/node/block"
+	"github.com/linguohua/titan/node/helper"
+)
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	bs := blockstore.NewBlockStore(t.TempDir(), "FileStore")
+	dataSync := &DataSync{
+		block:            block.NewBlock(ds, bs, nil, block.NewBitswap(nil), nil, "http://127.0.0.1:5001", 0),
+		ds:               ds,
+		blockStore:       bs,
+		reconcileLimiter: newReconcileLimiter(0),
+		reconcileLock:    &sync.Mutex{},
+	}
+
+	blks := make([]blocks.Block, 0)
+	for i := 1; i <= 6; i++ {
+		b := blocks.NewBlock([]byte(fmt.Sprintf("titan block %d", i)))
+		hash := b.Cid().Hash().String()
+		fid := fmt.Sprintf("%d", i)
+
+		switch i {
+		case 1, 2:
+			// block has no relation, orphan
+			if err := bs.Put(hash, b.RawData()); err != nil {
+				t.Fatal(err)
+			}
+		case 3:
+			// relation without block, missing
+			if err := ds.Put(ctx, helper.NewKeyFID(fid), []byte(hash)); err != nil {
+				t.Fatal(err)
+			}
+			if err := ds.Put(ctx, helper.NewKeyHash(hash), []byte(fid)); err != nil {
+				t.Fatal(err)
+			}
+		case 4:
+			// hash relation is lost
+			if err := bs.Put(hash, b.RawData()); err != nil {
+				t.Fatal(err)
+			}
+			if err := ds.Put(ctx, helper.NewKeyFID(fid), []byte(hash)); err != nil {
+				t.Fatal(err)
+			}
+		default:
+			if err := bs.Put(hash, b.RawData()); err != nil {
+				t.Fatal(err)
+			}
+			if err := ds.Put(ctx, helper.NewKeyFID(fid), []byte(hash)); err != nil {
+				t.Fatal(err)
+			}
+			if err := ds.Put(ctx, helper.NewKeyHash(hash), []byte(fid)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		blks = append(blks, b)
+	}
+
+	// dry run change nothing
+	report := api.ReconcileReport{DryRun: true}
+	if err := dataSync.reconcile(ctx, &report); err != nil {
+		t.Fatal(err)
+	}
+
+	if report.FidCount != 4 || report.BlockCount != 5 || report.FixedKeys != 1 || report.OrphanBlocks != 3 || report.MissingBlocks != 1 {
+		t.Fatalf("dry run report %+v", report)
+	}
+
+	report = api.ReconcileReport{}
+	if err := dataSync.reconcile(ctx, &report); err != nil {
+		t.Fatal(err)
+	}
+
+	// hash relation of block 4 is fixed before merge, so it is not orphan
+	if report.FixedKeys != 1 || report.OrphanBlocks != 2 || report.MissingBlocks != 1 {
+		t.Fatalf("reconcile report %+v", report)
+	}
+
+	if len(report.RefetchCids) != 1 || report.RefetchCids[0] != mustCidString(t, blks[2]) {
+		t.Fatalf("refetch cids %v, expect block 3", report.RefetchCids)
+	}
+
+	for i, b := range blks {
+		exist, err := bs.Has(b.Cid().Hash().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// block 1 and 2 are removed, block 3 can not be refetched without exchange
+		if expect := i >= 3; exist != expect {
+			t.Fatalf("block %d exist %v, expect %v", i+1, exist, expect)
+		}
+	}
+
+	if _, err := ds.Get(ctx, datastore.NewKey(reconcileCheckpointKey)); err != datastore.ErrNotFound {
+		t.Fatalf("checkpoint should be removed after complete, error %v", err)
+	}
+}
+
+func mustCidString(t *testing.T, b blocks.Block) string {
+	cid, err := helper.HashString2CidString(b.Cid().Hash().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cid
+}